@@ -0,0 +1,25 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatDotNetConnectionString(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{name: "plain", value: "secret", expected: "Host=localhost;Password=secret"},
+		{name: "separator", value: "se;cret", expected: `Host=localhost;Password="se;cret"`},
+		{name: "single quote", value: "it's", expected: `Host=localhost;Password="it's"`},
+		{name: "double quote", value: `say "hi" it's`, expected: `Host=localhost;Password='say "hi" it''s'`},
+		{name: "leading space", value: " secret", expected: `Host=localhost;Password=" secret"`},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, FormatDotNetConnectionString([][2]string{{"Host", "localhost"}, {"Password", testCase.value}}))
+		})
+	}
+}
@@ -4,15 +4,36 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"external-db-operator/internal/password"
 )
 
 type Type string
 
+// Provider manages databases and users on a database server. The context of a call bounds all statements it runs,
+// cancelling it aborts the running statement. Providers are used by concurrent workers and must be safe for concurrent
+// use once initialized.
 type Provider interface {
-	Initialize(dsn string) error
-	Apply(options CreateOptions) error
-	Destroy(options DestroyOptions) error
-	GetConnectionInfo() (ConnectionInfo, error)
+	Initialize(ctx context.Context, dsn string) error
+	Apply(ctx context.Context, options CreateOptions) error
+	Destroy(ctx context.Context, options DestroyOptions) error
+	ApplyUser(ctx context.Context, options UserOptions) error
+	DestroyUser(ctx context.Context, options UserOptions) error
+	ApplySchemas(ctx context.Context, options SchemaOptions) error
+	// DatabaseExists and UserExists report whether the database or user exists on the server, no matter who created it.
+	DatabaseExists(ctx context.Context, name string) (bool, error)
+	UserExists(ctx context.Context, name string) (bool, error)
+	// Dump writes a logical dump of the database to w, which recreates its schema and data when restored.
+	Dump(ctx context.Context, name string, w io.Writer) error
+	GetConnectionInfo(ctx context.Context) (ConnectionInfo, error)
+	ConnectionStrings(credentials Credentials) ConnectionStrings
+	// FormatDSN formats the dsn accepted by Initialize, passing the parameters on to the driver.
+	FormatDSN(credentials Credentials, parameters map[string]string) string
+	NamingRules() NamingRules
+	PasswordRequirements() password.Requirements
 	HealthCheck(ctx context.Context) error
 	io.Closer
 }
@@ -23,17 +44,182 @@ type ConnectionInfo struct {
 }
 
 type CreateOptions struct {
-	Name     string
+	// Name is the name of the database.
+	Name string
+	// Username is the name of the user owning the database.
+	Username string
+	// Password is set on the owner. An empty password keeps the current one, new owners are created without login.
 	Password string
+	// Logins are additional users sharing the privileges of the owner.
+	Logins []Login
+	// Charset is the default character set of the database (mysql).
+	Charset string
+	// Collation is the default collation of the database.
+	Collation string
+	// Encoding is the character encoding of the database (postgres).
+	Encoding string
+	// Locale sets the collation and character classification of the database (postgres).
+	Locale string
+	// Template is the database the new database is copied from (postgres).
+	Template string
+	// Privileges are granted to the owner and its logins on the database. If empty, all privileges are granted (mysql).
+	Privileges []string
+	// AllowedHosts are the hosts the owner and its logins may connect from. If empty, every host is allowed (mysql).
+	AllowedHosts []string
+	// Limits restrict the resources of the owner and each of its logins.
+	Limits Limits
+	// Extensions are installed into the database, and updated if their version changes (postgres).
+	Extensions []Extension
+	// DroppedExtensions are the names of extensions to remove from the database (postgres).
+	DroppedExtensions []string
+	Reporter          Reporter
 }
 
-type DestroyOptions struct {
+// Extension is a database extension, installed with the default version if the version is empty.
+type Extension struct {
+	Name    string
+	Version string
+}
+
+// Login is a user logging in on behalf of the database owner, as used by the dual user rotation.
+type Login struct {
+	Username string
+	// Password is set on the login. An empty password keeps the current one, new logins are created without login.
+	Password string
+}
+
+// Limits restrict the resources a user may consume on the database server. Zero values mean unlimited, or the server
+// default respectively. Limits changed on the server are reset on the next reconciliation.
+type Limits struct {
+	// ConnectionLimit is the maximum number of concurrent connections of the user.
+	ConnectionLimit int
+	// StatementTimeout aborts statements running longer (postgres).
+	StatementTimeout time.Duration
+	// IdleInTransactionSessionTimeout terminates sessions idling within an open transaction for longer (postgres).
+	IdleInTransactionSessionTimeout time.Duration
+	// MaxQueriesPerHour, MaxUpdatesPerHour and MaxConnectionsPerHour limit the statements and connections per hour (mysql).
+	MaxQueriesPerHour     int
+	MaxUpdatesPerHour     int
+	MaxConnectionsPerHour int
+}
+
+// SchemaOptions describe the schemas of a database, applied once the owner and all additional users exist (postgres).
+type SchemaOptions struct {
+	// Name is the name of the database.
+	Name    string
+	Schemas []Schema
+	// RevokePublicCreate revokes the CREATE privilege on the public schema from all users.
+	RevokePublicCreate bool
+	// SearchPaths are the schema search paths of users within the database.
+	SearchPaths map[string][]string
+	// Usernames are all users of the database. Search paths set before are reset for the users without a search path.
+	Usernames []string
+	Reporter  Reporter
+}
+
+// Schema is a schema within the database, owned by the owner of the database or an additional user.
+type Schema struct {
+	Name  string
+	Owner string
+}
+
+// UserProfile describes the privileges of an additional user on the database.
+type UserProfile string
+
+const (
+	// UserProfileOwner acts on behalf of the owner, including schema changes.
+	UserProfileOwner UserProfile = "owner"
+	// UserProfileReadWrite reads and writes the data of all tables, including tables created later on.
+	UserProfileReadWrite UserProfile = "readwrite"
+	// UserProfileReadOnly reads the data of all tables, including tables created later on.
+	UserProfileReadOnly UserProfile = "readonly"
+)
+
+func ListUserProfiles() []string {
+	return []string{string(UserProfileOwner), string(UserProfileReadWrite), string(UserProfileReadOnly)}
+}
+
+// UserOptions describe an additional user of a database, besides the owner.
+type UserOptions struct {
+	// Name is the name of the database.
 	Name string
+	// Owner is the name of the user owning the database.
+	Owner    string
+	Username string
+	// Password is set on the user. An empty password keeps the current one.
+	Password string
+	Profile  UserProfile
+	// Privileges are the privileges of the owner, which users of the owner profile share (mysql).
+	Privileges []string
+	// AllowedHosts are the hosts the user may connect from. If empty, every host is allowed (mysql).
+	AllowedHosts []string
+	// Limits restrict the resources of the user.
+	Limits Limits
+	// PreviousProfile is the profile applied before, its privileges are revoked if the profile changed.
+	PreviousProfile UserProfile
+	Reporter        Reporter
+}
+
+type DestroyOptions struct {
+	Name     string
+	Username string
+	// Logins are the logins and additional users of the database, which are removed along with the owner.
+	Logins []string
+	Policy DeletionPolicy
+	// RevokeLogin disables the login of the user, if the database is retained.
+	RevokeLogin bool
+	Reporter    Reporter
+}
+
+// Usernames lists the logins followed by the owner, in the order they are removed.
+func (o DestroyOptions) Usernames() []string {
+	return slices.Concat(o.Logins, []string{o.Username})
+}
+
+// DeletionPolicy describes what happens to the database and its user, once the database resource is deleted.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete drops the database and the user.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain keeps the database and the user.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicySnapshot writes a logical dump of the database before dropping the database and the user. The dump
+	// is taken through Provider.Dump, providers drop the database as for DeletionPolicyDelete afterwards.
+	DeletionPolicySnapshot DeletionPolicy = "Snapshot"
+)
+
+func ListDeletionPolicies() []string {
+	return []string{string(DeletionPolicyDelete), string(DeletionPolicyRetain), string(DeletionPolicySnapshot)}
+}
+
+// SnapshotName returns the name of the file holding the logical dump of the given database.
+func SnapshotName(name string, at time.Time) string {
+	return fmt.Sprintf("%s_%s.sql", name, at.UTC().Format("20060102150405"))
+}
+
+// Reporter is notified about every action a provider performs on the database server.
+type Reporter func(reason, message string)
+
+// Report logs the action and forwards it to the reporter, if one is set. It is meant for actions changing the database
+// server, which are only taken if the current state differs from the requested one.
+func (r Reporter) Report(reason, action, name string) {
+	slog.Info(action, slog.String("name", name))
+	if r != nil {
+		r(reason, action+" "+name)
+	}
+}
+
+// Enforce logs an action, which is taken on every reconciliation as the current state cannot be compared, e.g. setting
+// a password. It is not forwarded to the reporter, as the action most likely does not change anything.
+func (r Reporter) Enforce(action, name string) {
+	slog.Debug(action, slog.String("name", name))
 }
 
 var registeredProviders = map[string]ProviderInitializer{}
 
-type ProviderInitializer func() Provider
+// ProviderInitializer returns a new provider, which keeps a connection pool shaped by the settings once initialized.
+type ProviderInitializer func(pool PoolSettings) Provider
 
 func RegisterProvider(name string, initializer ProviderInitializer) {
 	registeredProviders[name] = initializer
@@ -55,11 +241,32 @@ func (e ErrUnknownProvider) Error() string {
 	return fmt.Sprintf("unknown provider: %s", e.Name)
 }
 
-func Provide(name string) (Provider, error) {
+// ErrImmutableProperty is returned if a property of an existing database is requested to change, which can only be set on creation.
+type ErrImmutableProperty struct {
+	Property  string
+	Current   string
+	Requested string
+}
+
+func (e ErrImmutableProperty) Error() string {
+	return fmt.Sprintf("%s of an existing database cannot be changed from %q to %q", e.Property, e.Current, e.Requested)
+}
+
+// ErrUnsupportedOption is returned if an option is requested, which the provider is not able to handle.
+type ErrUnsupportedOption struct {
+	Provider string
+	Option   string
+}
+
+func (e ErrUnsupportedOption) Error() string {
+	return fmt.Sprintf("option %s is not supported by the %s provider", e.Option, e.Provider)
+}
+
+func Provide(name string, pool PoolSettings) (Provider, error) {
 	providerInitializer, found := registeredProviders[name]
 	if !found {
 		return nil, ErrUnknownProvider{Name: name}
 	}
 
-	return providerInitializer(), nil
+	return providerInitializer(pool), nil
 }
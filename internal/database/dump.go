@@ -0,0 +1,36 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"external-db-operator/internal/helper"
+)
+
+// RunDump runs the dump command of a provider, writing its output to w. The environment passes the credentials, so
+// they do not show up in the process list. A missing command is a permanent error, as the image lacks the client.
+func RunDump(ctx context.Context, w io.Writer, environment []string, command string, arguments ...string) error {
+	var stderr bytes.Buffer
+	dumpCommand := exec.CommandContext(ctx, command, arguments...)
+	dumpCommand.Env = append(os.Environ(), environment...)
+	dumpCommand.Stdout = w
+	dumpCommand.Stderr = &stderr
+
+	runError := dumpCommand.Run()
+	if errors.Is(runError, exec.ErrNotFound) {
+		return helper.Permanent(fmt.Errorf("failed to run %s: %w", command, runError))
+	}
+	if runError != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%s failed: %w: %s", command, runError, message)
+		}
+		return fmt.Errorf("%s failed: %w", command, runError)
+	}
+	return nil
+}
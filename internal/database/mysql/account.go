@@ -0,0 +1,84 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+)
+
+// anyHost is the host part of accounts which may connect from everywhere.
+const anyHost = "%"
+
+// normalizeHosts lowercases the allowed hosts the way the server stores them and removes duplicates.
+// Without any hosts, connections from every host are allowed.
+func normalizeHosts(hosts []string) ([]string, error) {
+	var normalized []string
+	for _, host := range hosts {
+		if host == "" {
+			return nil, helper.Permanent(errors.New("allowed hosts must not be empty"))
+		}
+		if host = strings.ToLower(host); !slices.Contains(normalized, host) {
+			normalized = append(normalized, host)
+		}
+	}
+
+	if len(normalized) == 0 {
+		return []string{anyHost}, nil
+	}
+	return normalized, nil
+}
+
+// listHosts returns the host parts of all accounts of the user.
+func (p *Provider) listHosts(ctx context.Context, username string) ([]string, error) {
+	rows, queryError := p.dbConnection.QueryContext(ctx, "SELECT host FROM mysql.user WHERE user = ?", username)
+	if queryError != nil {
+		return nil, queryError
+	}
+	defer rows.Close()
+
+	var hosts []string
+	for rows.Next() {
+		var host string
+		if scanError := rows.Scan(&host); scanError != nil {
+			return nil, scanError
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, rows.Err()
+}
+
+// dropUser drops the accounts of the user for every host.
+func (p *Provider) dropUser(ctx context.Context, username string, reporter database.Reporter) error {
+	hosts, listHostsError := p.listHosts(ctx, username)
+	if listHostsError != nil {
+		return listHostsError
+	}
+
+	reporter.Report("DestroyingUser", "destroying user", username)
+	for _, host := range hosts {
+		if _, dropUserError := p.dbConnection.ExecContext(ctx, "DROP USER IF EXISTS "+quoteAccount(username, host)); dropUserError != nil {
+			return dropUserError
+		}
+	}
+	return nil
+}
+
+// lockUser disables the login of the user for every host.
+func (p *Provider) lockUser(ctx context.Context, username string, reporter database.Reporter) error {
+	hosts, listHostsError := p.listHosts(ctx, username)
+	if listHostsError != nil {
+		return listHostsError
+	}
+
+	reporter.Report("RevokingLogin", "revoking login", username)
+	for _, host := range hosts {
+		if _, lockUserError := p.dbConnection.ExecContext(ctx, "ALTER USER IF EXISTS "+quoteAccount(username, host)+" ACCOUNT LOCK"); lockUserError != nil {
+			return lockUserError
+		}
+	}
+	return nil
+}
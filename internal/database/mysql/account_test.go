@@ -0,0 +1,31 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeHosts(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		input    []string
+		expected []string
+		isValid  bool
+	}{
+		{name: "default", input: nil, expected: []string{anyHost}, isValid: true},
+		{name: "patterns", input: []string{"10.0.%", "App.Example.com"}, expected: []string{"10.0.%", "app.example.com"}, isValid: true},
+		{name: "duplicates", input: []string{"10.0.%", "10.0.%"}, expected: []string{"10.0.%"}, isValid: true},
+		{name: "empty host", input: []string{""}, isValid: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, normalizeError := normalizeHosts(testCase.input)
+			if !testCase.isValid {
+				assert.Error(t, normalizeError)
+				return
+			}
+			assert.NoError(t, normalizeError)
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package mysql
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+)
+
+// Dump writes a sql dump of the database with mysqldump, which recreates the database itself as well.
+func (p *Provider) Dump(ctx context.Context, name string, w io.Writer) error {
+	environment, arguments, parseError := dumpArguments(p.dsn, name)
+	if parseError != nil {
+		return helper.Permanent(parseError)
+	}
+	return database.RunDump(ctx, w, environment, "mysqldump", arguments...)
+}
+
+// dumpArguments derives the environment and arguments of mysqldump from the dsn. The dump includes the routines,
+// triggers and events of the database and is taken in a single transaction, without locking the tables.
+func dumpArguments(dsn, name string) ([]string, []string, error) {
+	config, parseError := mysql.ParseDSN(dsn)
+	if parseError != nil {
+		return nil, nil, parseError
+	}
+
+	arguments := []string{"--single-transaction", "--routines", "--triggers", "--events", "--user=" + config.User}
+	if config.Net == "unix" {
+		arguments = append(arguments, "--socket="+config.Addr)
+	} else {
+		host, port, splitAddressError := net.SplitHostPort(config.Addr)
+		if splitAddressError != nil {
+			return nil, nil, splitAddressError
+		}
+		arguments = append(arguments, "--protocol=TCP", "--host="+host, "--port="+port)
+	}
+	switch config.TLSConfig {
+	case "", "false":
+		arguments = append(arguments, "--skip-ssl")
+	case "skip-verify", "preferred":
+		arguments = append(arguments, "--ssl")
+	default:
+		arguments = append(arguments, "--ssl", "--ssl-verify-server-cert")
+	}
+	arguments = append(arguments, "--databases", name)
+
+	return []string{"MYSQL_PWD=" + config.Passwd}, arguments, nil
+}
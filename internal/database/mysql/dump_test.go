@@ -0,0 +1,42 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpArguments(t *testing.T) {
+	for _, testCase := range []struct {
+		name                string
+		dsn                 string
+		expectedEnvironment []string
+		expectedArguments   []string
+	}{
+		{
+			name:                "tcp",
+			dsn:                 "admin:secret@tcp(db.example.com:3307)/",
+			expectedEnvironment: []string{"MYSQL_PWD=secret"},
+			expectedArguments:   []string{"--single-transaction", "--routines", "--triggers", "--events", "--user=admin", "--protocol=TCP", "--host=db.example.com", "--port=3307", "--skip-ssl", "--databases", "app"},
+		},
+		{
+			name:                "unix socket with tls",
+			dsn:                 "root@unix(/run/mysqld/mysqld.sock)/mysql?tls=true",
+			expectedEnvironment: []string{"MYSQL_PWD="},
+			expectedArguments:   []string{"--single-transaction", "--routines", "--triggers", "--events", "--user=root", "--socket=/run/mysqld/mysqld.sock", "--ssl", "--ssl-verify-server-cert", "--databases", "app"},
+		},
+		{
+			name:                "tls without verification",
+			dsn:                 "admin:secret@tcp(db:3306)/?tls=skip-verify",
+			expectedEnvironment: []string{"MYSQL_PWD=secret"},
+			expectedArguments:   []string{"--single-transaction", "--routines", "--triggers", "--events", "--user=admin", "--protocol=TCP", "--host=db", "--port=3306", "--ssl", "--databases", "app"},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			environment, arguments, parseError := dumpArguments(testCase.dsn, "app")
+			assert.NoError(t, parseError)
+			assert.Equal(t, testCase.expectedEnvironment, environment)
+			assert.Equal(t, testCase.expectedArguments, arguments)
+		})
+	}
+}
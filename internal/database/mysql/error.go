@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+
+	"external-db-operator/internal/helper"
+)
+
+// permanentErrorNumbers lists the server error numbers which indicate a problem with the request itself.
+// Retrying a statement failing with one of those errors will not succeed without a change to the resource.
+var permanentErrorNumbers = map[uint16]bool{
+	1044: true, // ER_DBACCESS_DENIED_ERROR
+	1045: true, // ER_ACCESS_DENIED_ERROR
+	1059: true, // ER_TOO_LONG_IDENT
+	1064: true, // ER_PARSE_ERROR
+	1102: true, // ER_WRONG_DB_NAME
+	1115: true, // ER_UNKNOWN_CHARACTER_SET
+	1227: true, // ER_SPECIFIC_ACCESS_DENIED_ERROR
+	1273: true, // ER_UNKNOWN_COLLATION
+	1396: true, // ER_CANNOT_USER
+	1470: true, // ER_WRONG_STRING_LENGTH
+}
+
+// classifyError marks errors reported by the server as permanent, if retrying the statement is pointless.
+func classifyError(err error) error {
+	var mysqlError *mysql.MySQLError
+	if errors.As(err, &mysqlError) && permanentErrorNumbers[mysqlError.Number] {
+		return helper.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+)
+
+// allPrivileges covers every privilege on the database, it is granted to the owner unless privileges are requested.
+const allPrivileges = "ALL PRIVILEGES"
+
+// databasePrivileges are the privileges which can be granted on a database, in the notation of SHOW GRANTS.
+var databasePrivileges = []string{
+	"SELECT", "INSERT", "UPDATE", "DELETE", "CREATE", "DROP", "REFERENCES", "INDEX", "ALTER", "CREATE TEMPORARY TABLES",
+	"LOCK TABLES", "EXECUTE", "CREATE VIEW", "SHOW VIEW", "CREATE ROUTINE", "ALTER ROUTINE", "EVENT", "TRIGGER",
+}
+
+// normalizePrivileges validates the requested privileges and brings them into the notation of SHOW GRANTS.
+// Without any privileges, all privileges are granted.
+func normalizePrivileges(privileges []string) ([]string, error) {
+	var normalized []string
+	for _, privilege := range privileges {
+		privilege = strings.ToUpper(strings.Join(strings.Fields(privilege), " "))
+		if privilege == "ALL" {
+			privilege = allPrivileges
+		}
+		if privilege != allPrivileges && !slices.Contains(databasePrivileges, privilege) {
+			return nil, helper.Permanent(database.ErrUnsupportedOption{Provider: "mysql", Option: "privilege " + privilege})
+		}
+		if !slices.Contains(normalized, privilege) {
+			normalized = append(normalized, privilege)
+		}
+	}
+
+	if len(normalized) == 0 || slices.Contains(normalized, allPrivileges) {
+		return []string{allPrivileges}, nil
+	}
+	return normalized, nil
+}
+
+// parseGrants extracts the privileges on the database from the output of SHOW GRANTS, as well as whether the user
+// may pass them on to others.
+func parseGrants(grants []string, name string) (privileges []string, grantOption bool) {
+	target := " ON " + quoteIdentifier(name) + ".* TO "
+	for _, grant := range grants {
+		privilegeList, isGrant := strings.CutPrefix(grant, "GRANT ")
+		index := strings.Index(privilegeList, target)
+		if !isGrant || index < 0 {
+			continue
+		}
+
+		grantOption = grantOption || strings.HasSuffix(grant, " WITH GRANT OPTION")
+		for _, privilege := range strings.Split(privilegeList[:index], ", ") {
+			if privilege == "ALL" {
+				privilege = allPrivileges
+			}
+			if privilege != "USAGE" && !slices.Contains(privileges, privilege) {
+				privileges = append(privileges, privilege)
+			}
+		}
+	}
+	return privileges, grantOption
+}
+
+// reconcileGrants grants the normalized privileges on the database to the accounts of the user for all hosts.
+func (p *Provider) reconcileGrants(ctx context.Context, name, username string, hosts, privileges []string, reporter database.Reporter) error {
+	for _, host := range hosts {
+		if grantError := p.reconcileAccountGrants(ctx, name, username, host, privileges, reporter); grantError != nil {
+			return grantError
+		}
+	}
+	return nil
+}
+
+// reconcileAccountGrants grants the normalized privileges on the database to the account and revokes all others,
+// compared against the current grants of the account.
+func (p *Provider) reconcileAccountGrants(ctx context.Context, name, username, host string, privileges []string, reporter database.Reporter) error {
+	account := quoteAccount(username, host)
+	grants, showGrantsError := p.showGrants(ctx, account)
+	if showGrantsError != nil {
+		return showGrantsError
+	}
+	current, grantOption := parseGrants(grants, name)
+
+	target := quoteIdentifier(name) + ".*"
+	accountName := username + "@" + host
+	grantsAll := slices.Equal(privileges, []string{allPrivileges})
+
+	// the privileges covered by ALL PRIVILEGES differ between servers, so it is revoked as a whole
+	if slices.Contains(current, allPrivileges) && !grantsAll {
+		reporter.Report("RevokingPrivileges", "revoking "+allPrivileges+" of user", accountName)
+		if _, revokeError := p.dbConnection.ExecContext(ctx, "REVOKE ALL PRIVILEGES ON "+target+" FROM "+account); revokeError != nil {
+			return revokeError
+		}
+		current = nil
+	}
+
+	if missing := difference(privileges, current); len(missing) > 0 {
+		reporter.Report("GrantingPrivileges", "granting "+strings.Join(missing, ", ")+" to user", accountName)
+		if _, grantError := p.dbConnection.ExecContext(ctx, "GRANT "+strings.Join(missing, ", ")+" ON "+target+" TO "+account); grantError != nil {
+			return grantError
+		}
+	}
+
+	if superfluous := difference(current, privileges); len(superfluous) > 0 && !grantsAll {
+		reporter.Report("RevokingPrivileges", "revoking "+strings.Join(superfluous, ", ")+" of user", accountName)
+		if _, revokeError := p.dbConnection.ExecContext(ctx, "REVOKE "+strings.Join(superfluous, ", ")+" ON "+target+" FROM "+account); revokeError != nil {
+			return revokeError
+		}
+	}
+
+	if grantOption {
+		reporter.Report("RevokingPrivileges", "revoking GRANT OPTION of user", accountName)
+		if _, revokeError := p.dbConnection.ExecContext(ctx, "REVOKE GRANT OPTION ON "+target+" FROM "+account); revokeError != nil {
+			return revokeError
+		}
+	}
+
+	return nil
+}
+
+func (p *Provider) showGrants(ctx context.Context, account string) ([]string, error) {
+	rows, queryError := p.dbConnection.QueryContext(ctx, "SHOW GRANTS FOR "+account)
+	if queryError != nil {
+		return nil, queryError
+	}
+	defer rows.Close()
+
+	var grants []string
+	for rows.Next() {
+		var grant string
+		if scanError := rows.Scan(&grant); scanError != nil {
+			return nil, scanError
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+// difference returns the privileges of a, which are not part of b.
+func difference(a, b []string) []string {
+	return slices.DeleteFunc(slices.Clone(a), func(privilege string) bool { return slices.Contains(b, privilege) })
+}
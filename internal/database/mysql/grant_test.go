@@ -0,0 +1,68 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizePrivileges(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		input    []string
+		expected []string
+		isValid  bool
+	}{
+		{name: "default", input: nil, expected: []string{allPrivileges}, isValid: true},
+		{name: "explicit", input: []string{"select", "Insert", "create  temporary tables"}, expected: []string{"SELECT", "INSERT", "CREATE TEMPORARY TABLES"}, isValid: true},
+		{name: "duplicates", input: []string{"SELECT", "select"}, expected: []string{"SELECT"}, isValid: true},
+		{name: "all", input: []string{"SELECT", "ALL"}, expected: []string{allPrivileges}, isValid: true},
+		{name: "grant option", input: []string{"GRANT OPTION"}, isValid: false},
+		{name: "global privilege", input: []string{"SUPER"}, isValid: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, normalizeError := normalizePrivileges(testCase.input)
+			if !testCase.isValid {
+				assert.Error(t, normalizeError)
+				return
+			}
+			assert.NoError(t, normalizeError)
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestParseGrants(t *testing.T) {
+	for _, testCase := range []struct {
+		name                string
+		grants              []string
+		expectedPrivileges  []string
+		expectedGrantOption bool
+	}{
+		{
+			name:   "usage only",
+			grants: []string{"GRANT USAGE ON *.* TO `foo_bar`@`%`"},
+		},
+		{
+			name:               "all privileges",
+			grants:             []string{"GRANT USAGE ON *.* TO `foo_bar`@`%`", "GRANT ALL PRIVILEGES ON `foo_bar`.* TO `foo_bar`@`%`"},
+			expectedPrivileges: []string{allPrivileges},
+		},
+		{
+			name:                "privilege list with grant option",
+			grants:              []string{"GRANT SELECT, INSERT, CREATE TEMPORARY TABLES ON `foo_bar`.* TO `foo_bar`@`%` WITH GRANT OPTION"},
+			expectedPrivileges:  []string{"SELECT", "INSERT", "CREATE TEMPORARY TABLES"},
+			expectedGrantOption: true,
+		},
+		{
+			name:   "other database",
+			grants: []string{"GRANT SELECT ON `foo_bar_snapshot`.* TO `foo_bar`@`%`", "GRANT SELECT ON `foo_bar`.`table` TO `foo_bar`@`%`"},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			privileges, grantOption := parseGrants(testCase.grants, "foo_bar")
+			assert.Equal(t, testCase.expectedPrivileges, privileges)
+			assert.Equal(t, testCase.expectedGrantOption, grantOption)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+)
+
+// verifyLimits rejects limits mysql is not able to enforce per user.
+func verifyLimits(limits database.Limits) error {
+	if limits.StatementTimeout != 0 {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "mysql", Option: "statementTimeout"})
+	}
+	if limits.IdleInTransactionSessionTimeout != 0 {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "mysql", Option: "idleInTransactionSessionTimeout"})
+	}
+	return nil
+}
+
+// applyLimits sets the resource limits of the accounts of the user for all hosts, if they differ from the current ones.
+func (p *Provider) applyLimits(ctx context.Context, username string, hosts []string, limits database.Limits, reporter database.Reporter) error {
+	for _, host := range hosts {
+		var current database.Limits
+		queryError := p.dbConnection.QueryRowContext(ctx, "SELECT max_questions, max_updates, max_connections, max_user_connections FROM mysql.user WHERE user = ? AND LOWER(host) = ?", username, host).
+			Scan(&current.MaxQueriesPerHour, &current.MaxUpdatesPerHour, &current.MaxConnectionsPerHour, &current.ConnectionLimit)
+		if queryError != nil {
+			return queryError
+		}
+		if current == limits {
+			continue
+		}
+
+		reporter.Report("ApplyingLimits", "apply limits to user", username+"@"+host)
+		_, alterUserError := p.dbConnection.ExecContext(ctx, fmt.Sprintf("ALTER USER %s WITH MAX_QUERIES_PER_HOUR %d MAX_UPDATES_PER_HOUR %d MAX_CONNECTIONS_PER_HOUR %d MAX_USER_CONNECTIONS %d",
+			quoteAccount(username, host), limits.MaxQueriesPerHour, limits.MaxUpdatesPerHour, limits.MaxConnectionsPerHour, limits.ConnectionLimit))
+		if alterUserError != nil {
+			return alterUserError
+		}
+	}
+	return nil
+}
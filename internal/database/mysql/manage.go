@@ -1,100 +1,320 @@
 package mysql
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
-	"log/slog"
 	"net"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
 
 	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	"external-db-operator/internal/password"
 )
 
 func init() {
 	database.RegisterProvider("mysql", Provide)
 }
 
-func Provide() database.Provider {
-	return &Provider{}
+func Provide(pool database.PoolSettings) database.Provider {
+	return &Provider{pool: pool}
 }
 
 type Provider struct {
 	dbConnection *sql.DB
 	dsn          string
+	pool         database.PoolSettings
+	// noBackslashEscapes reflects the NO_BACKSLASH_ESCAPES sql mode of the server, which changes how literals are quoted.
+	noBackslashEscapes bool
+	// passwordRequirements are enforced by the password validation plugin of the server, if installed.
+	passwordRequirements password.Requirements
 }
 
 var _ database.Provider = &Provider{}
 
-func (p *Provider) Initialize(dsn string) error {
+func (p *Provider) Initialize(ctx context.Context, dsn string) error {
 	db, dbInitialisationError := sql.Open("mysql", dsn)
 	if dbInitialisationError != nil {
 		return dbInitialisationError
 	}
 
-	db.SetConnMaxLifetime(time.Minute * 3)
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(10)
+	configurePool(db, p.pool)
+
+	var sqlMode string
+	if sqlModeError := db.QueryRowContext(ctx, "SELECT @@SESSION.sql_mode").Scan(&sqlMode); sqlModeError != nil {
+		db.Close()
+		return sqlModeError
+	}
+
+	passwordVariables, passwordVariablesError := queryPasswordVariables(ctx, db)
+	if passwordVariablesError != nil {
+		db.Close()
+		return passwordVariablesError
+	}
 
 	p.dbConnection = db
 	p.dsn = dsn
+	p.noBackslashEscapes = strings.Contains(strings.ToUpper(sqlMode), "NO_BACKSLASH_ESCAPES")
+	p.passwordRequirements = passwordRequirements(passwordVariables)
 
 	return nil
 }
 
-func (p *Provider) Apply(options database.CreateOptions) error {
-	slog.Info("creating database", slog.String("name", options.Name))
-	_, databaseCreateError := p.dbConnection.Exec("CREATE DATABASE IF NOT EXISTS " + options.Name)
-	if databaseCreateError != nil {
-		return databaseCreateError
+// configurePool sizes the connection pool, keeping up to ten connections for three minutes unless set otherwise.
+func configurePool(db *sql.DB, pool database.PoolSettings) {
+	maxConnections := cmp.Or(pool.MaxConnections, 10)
+	db.SetConnMaxLifetime(cmp.Or(pool.ConnectionLifetime, 3*time.Minute))
+	db.SetMaxOpenConns(maxConnections)
+	db.SetMaxIdleConns(maxConnections)
+}
+
+// queryPasswordVariables reads the settings of the MySQL validate_password component or plugin and the MariaDB simple_password_check plugin.
+func queryPasswordVariables(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	rows, queryError := db.QueryContext(ctx, "SHOW VARIABLES WHERE Variable_name LIKE 'validate_password%' OR Variable_name LIKE 'simple_password_check%'")
+	if queryError != nil {
+		return nil, queryError
+	}
+	defer rows.Close()
+
+	variables := map[string]string{}
+	for rows.Next() {
+		var name, value string
+		if scanError := rows.Scan(&name, &value); scanError != nil {
+			return nil, scanError
+		}
+		// the validate_password component of MySQL 8 uses dots, the plugin of MySQL 5.7 underscores
+		variables[strings.ReplaceAll(strings.ToLower(name), ".", "_")] = value
+	}
+	return variables, rows.Err()
+}
+
+// passwordRequirements derives the password requirements from the server variables.
+func passwordRequirements(variables map[string]string) password.Requirements {
+	number := func(name string) int {
+		value, _ := strconv.Atoi(variables[name])
+		return value
+	}
+
+	var requirements password.Requirements
+	if _, installed := variables["validate_password_length"]; installed {
+		requirements.MinLength = number("validate_password_length")
+		// the LOW policy only checks the length
+		if policy := strings.ToUpper(variables["validate_password_policy"]); policy != "LOW" && policy != "0" {
+			requirements.MinLowercase = number("validate_password_mixed_case_count")
+			requirements.MinUppercase = number("validate_password_mixed_case_count")
+			requirements.MinDigits = number("validate_password_number_count")
+			requirements.MinSpecial = number("validate_password_special_char_count")
+		}
+	}
+	if _, installed := variables["simple_password_check_minimal_length"]; installed {
+		requirements.MinLength = max(requirements.MinLength, number("simple_password_check_minimal_length"))
+		requirements.MinLowercase = max(requirements.MinLowercase, number("simple_password_check_letters_same_case"))
+		requirements.MinUppercase = max(requirements.MinUppercase, number("simple_password_check_letters_same_case"))
+		requirements.MinDigits = max(requirements.MinDigits, number("simple_password_check_digits"))
+		requirements.MinSpecial = max(requirements.MinSpecial, number("simple_password_check_other_characters"))
+	}
+	return requirements
+}
+
+func (p *Provider) PasswordRequirements() password.Requirements {
+	return p.passwordRequirements
+}
+
+func (p *Provider) Apply(ctx context.Context, options database.CreateOptions) error {
+	for option, value := range map[string]string{"encoding": options.Encoding, "locale": options.Locale, "template": options.Template} {
+		if value != "" {
+			return helper.Permanent(database.ErrUnsupportedOption{Provider: "mysql", Option: option})
+		}
+	}
+	if len(options.Extensions) > 0 || len(options.DroppedExtensions) > 0 {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "mysql", Option: "extensions"})
+	}
+	privileges, normalizeError := normalizePrivileges(options.Privileges)
+	if normalizeError != nil {
+		return normalizeError
+	}
+	hosts, normalizeError := normalizeHosts(options.AllowedHosts)
+	if normalizeError != nil {
+		return normalizeError
+	}
+	if verifyError := verifyLimits(options.Limits); verifyError != nil {
+		return verifyError
+	}
+
+	databaseExists, checkDatabaseError := p.DatabaseExists(ctx, options.Name)
+	if checkDatabaseError != nil {
+		return classifyError(checkDatabaseError)
+	}
+	if !databaseExists {
+		options.Reporter.Report("CreatingDatabase", "creating database", options.Name)
+		_, databaseCreateError := p.dbConnection.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS "+quoteIdentifier(options.Name)+p.databaseCharsetClause(options))
+		if databaseCreateError != nil {
+			return classifyError(databaseCreateError)
+		}
+	}
+	if alterDatabaseError := p.applyDatabaseCharset(ctx, options); alterDatabaseError != nil {
+		return classifyError(alterDatabaseError)
+	}
+
+	if applyUserError := p.applyUser(ctx, options.Username, options.Password, hosts, options.Reporter); applyUserError != nil {
+		return classifyError(applyUserError)
+	}
+	if applyLimitsError := p.applyLimits(ctx, options.Username, hosts, options.Limits, options.Reporter); applyLimitsError != nil {
+		return classifyError(applyLimitsError)
+	}
+
+	if grantError := p.reconcileGrants(ctx, options.Name, options.Username, hosts, privileges, options.Reporter); grantError != nil {
+		return classifyError(grantError)
+	}
+
+	// MySQL has no ownership of objects, the logins are granted the privileges of the owner instead
+	for _, login := range options.Logins {
+		if applyLoginError := p.applyUser(ctx, login.Username, login.Password, hosts, options.Reporter); applyLoginError != nil {
+			return classifyError(applyLoginError)
+		}
+		if applyLimitsError := p.applyLimits(ctx, login.Username, hosts, options.Limits, options.Reporter); applyLimitsError != nil {
+			return classifyError(applyLimitsError)
+		}
+		if grantError := p.reconcileGrants(ctx, options.Name, login.Username, hosts, privileges, options.Reporter); grantError != nil {
+			return classifyError(grantError)
+		}
 	}
 
-	// check if user exists
-	var userExists bool
-	checkUserError := p.dbConnection.QueryRow("SELECT EXISTS(SELECT 1 FROM mysql.user WHERE user = ?)", options.Name).Scan(&userExists)
-	if checkUserError != nil {
-		return checkUserError
+	return nil
+}
+
+// applyUser creates or updates the accounts of the user for the given hosts, and drops the accounts of all other hosts.
+// An empty password keeps the current one, new accounts are created locked until the next password is set.
+func (p *Provider) applyUser(ctx context.Context, username, password string, hosts []string, reporter database.Reporter) error {
+	existingHosts, listHostsError := p.listHosts(ctx, username)
+	if listHostsError != nil {
+		return listHostsError
 	}
 
-	if userExists {
-		slog.Info("alter user", slog.String("name", options.Name))
-		if _, alterUserError := p.dbConnection.Exec("ALTER USER " + options.Name + " IDENTIFIED BY '" + options.Password + "'"); alterUserError != nil {
-			return alterUserError
+	for _, host := range hosts {
+		accountExists := slices.ContainsFunc(existingHosts, func(existingHost string) bool { return strings.EqualFold(existingHost, host) })
+
+		switch {
+		case accountExists && password == "":
+			continue
+		case accountExists:
+			// the password cannot be read back, so it is set again on every reconciliation
+			reporter.Enforce("alter user", username+"@"+host)
+		default:
+			reporter.Report("CreatingUser", "create user", username+"@"+host)
 		}
-	} else {
-		slog.Info("create user", slog.String("name", options.Name))
-		if _, createUserError := p.dbConnection.Exec("CREATE USER IF NOT EXISTS " + options.Name + " IDENTIFIED BY '" + options.Password + "'"); createUserError != nil {
-			return createUserError
+		if _, applyAccountError := p.dbConnection.ExecContext(ctx, p.applyAccountStatement(username, host, password, accountExists)); applyAccountError != nil {
+			return applyAccountError
 		}
 	}
 
-	slog.Info("apply database ownership", slog.String("name", options.Name))
-	if _, grantPrivileges := p.dbConnection.Exec("GRANT ALL PRIVILEGES ON " + options.Name + ".* TO '" + options.Name + "'"); grantPrivileges != nil {
-		return grantPrivileges
+	for _, existingHost := range existingHosts {
+		if slices.ContainsFunc(hosts, func(host string) bool { return strings.EqualFold(existingHost, host) }) {
+			continue
+		}
+		reporter.Report("DroppingUserHost", "drop user", username+"@"+existingHost)
+		if _, dropAccountError := p.dbConnection.ExecContext(ctx, "DROP USER IF EXISTS "+quoteAccount(username, existingHost)); dropAccountError != nil {
+			return dropAccountError
+		}
 	}
 
 	return nil
 }
 
-func (p *Provider) Destroy(options database.DestroyOptions) error {
-	slog.Info("destroying database", slog.String("name", options.Name))
-	_, dbDestroyError := p.dbConnection.Exec("DROP DATABASE IF EXISTS " + options.Name)
+// applyAccountStatement returns the statement creating the account or setting the password of the existing one.
+func (p *Provider) applyAccountStatement(username, host, password string, accountExists bool) string {
+	account := quoteAccount(username, host)
+	switch {
+	case accountExists:
+		return "ALTER USER " + account + " IDENTIFIED BY " + p.quoteLiteral(password) + " ACCOUNT UNLOCK"
+	case password == "":
+		return "CREATE USER IF NOT EXISTS " + account + " ACCOUNT LOCK"
+	default:
+		return "CREATE USER IF NOT EXISTS " + account + " IDENTIFIED BY " + p.quoteLiteral(password)
+	}
+}
+
+func (p *Provider) databaseCharsetClause(options database.CreateOptions) string {
+	var clause string
+	if options.Charset != "" {
+		clause += " CHARACTER SET " + p.quoteLiteral(options.Charset)
+	}
+	if options.Collation != "" {
+		clause += " COLLATE " + p.quoteLiteral(options.Collation)
+	}
+	return clause
+}
+
+// applyDatabaseCharset changes the defaults of an existing database, if they differ from the requested ones.
+// Existing tables keep their character set and collation.
+func (p *Provider) applyDatabaseCharset(ctx context.Context, options database.CreateOptions) error {
+	if options.Charset == "" && options.Collation == "" {
+		return nil
+	}
+
+	var charset, collation string
+	if queryError := p.dbConnection.QueryRowContext(ctx, "SELECT DEFAULT_CHARACTER_SET_NAME, DEFAULT_COLLATION_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", options.Name).Scan(&charset, &collation); queryError != nil {
+		return queryError
+	}
+	if (options.Charset == "" || strings.EqualFold(options.Charset, charset)) && (options.Collation == "" || strings.EqualFold(options.Collation, collation)) {
+		return nil
+	}
+
+	options.Reporter.Report("AlteringDatabase", "alter database", options.Name)
+	_, alterDatabaseError := p.dbConnection.ExecContext(ctx, "ALTER DATABASE "+quoteIdentifier(options.Name)+p.databaseCharsetClause(options))
+	return alterDatabaseError
+}
+
+// NamingRules reflects the identifier limits of MySQL; MariaDB allows longer user names.
+// The system schemas and the user of the operator itself are reserved.
+func (p *Provider) NamingRules() database.NamingRules {
+	reservedUserNames := []string{"root"}
+	if config, dsnParseError := mysql.ParseDSN(p.dsn); dsnParseError == nil {
+		reservedUserNames = append(reservedUserNames, config.User)
+	}
+	return database.NamingRules{
+		MaxDatabaseNameLength: 64,
+		MaxUserNameLength:     32,
+		ReservedDatabaseNames: []string{"mysql", "information_schema", "performance_schema", "sys"},
+		ReservedUserNames:     reservedUserNames,
+	}
+}
+
+func (p *Provider) Destroy(ctx context.Context, options database.DestroyOptions) error {
+	switch options.Policy {
+	case database.DeletionPolicyRetain:
+		if options.RevokeLogin {
+			for _, username := range options.Usernames() {
+				if revokeLoginError := p.lockUser(ctx, username, options.Reporter); revokeLoginError != nil {
+					return classifyError(revokeLoginError)
+				}
+			}
+		}
+		return nil
+	}
+
+	options.Reporter.Report("DestroyingDatabase", "destroying database", options.Name)
+	_, dbDestroyError := p.dbConnection.ExecContext(ctx, "DROP DATABASE IF EXISTS "+quoteIdentifier(options.Name))
 	if dbDestroyError != nil {
-		return dbDestroyError
+		return classifyError(dbDestroyError)
 	}
 
-	slog.Info("destroying user", slog.String("name", options.Name))
-	_, userDestroyError := p.dbConnection.Exec("DROP USER IF EXISTS " + options.Name)
-	if userDestroyError != nil {
-		return userDestroyError
+	for _, username := range options.Usernames() {
+		if userDestroyError := p.dropUser(ctx, username, options.Reporter); userDestroyError != nil {
+			return classifyError(userDestroyError)
+		}
 	}
 
 	return nil
 }
 
-func (p *Provider) GetConnectionInfo() (database.ConnectionInfo, error) {
+func (p *Provider) GetConnectionInfo(_ context.Context) (database.ConnectionInfo, error) {
 	config, dsnParseError := mysql.ParseDSN(p.dsn)
 	if dsnParseError != nil {
 		return database.ConnectionInfo{}, dsnParseError
@@ -112,6 +332,52 @@ func (p *Provider) GetConnectionInfo() (database.ConnectionInfo, error) {
 	}, nil
 }
 
+func (p *Provider) ConnectionStrings(credentials database.Credentials) database.ConnectionStrings {
+	address := net.JoinHostPort(credentials.Host, strconv.Itoa(int(credentials.Port)))
+	uri := url.URL{
+		Scheme: "mysql",
+		User:   url.UserPassword(credentials.Username, credentials.Password),
+		Host:   address,
+		Path:   "/" + credentials.Database,
+	}
+	jdbcParameters := url.Values{"user": {credentials.Username}, "password": {credentials.Password}}
+
+	return database.ConnectionStrings{
+		URI:     uri.String(),
+		JDBCURL: "jdbc:mysql://" + address + "/" + url.PathEscape(credentials.Database) + "?" + jdbcParameters.Encode(),
+		DotNetConnectionString: database.FormatDotNetConnectionString([][2]string{
+			{"Server", credentials.Host},
+			{"Port", strconv.Itoa(int(credentials.Port))},
+			{"Database", credentials.Database},
+			{"User ID", credentials.Username},
+			{"Password", credentials.Password},
+		}),
+	}
+}
+
+func (p *Provider) FormatDSN(credentials database.Credentials, parameters map[string]string) string {
+	config := mysql.NewConfig()
+	config.User = credentials.Username
+	config.Passwd = credentials.Password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(credentials.Host, strconv.Itoa(int(credentials.Port)))
+	config.DBName = credentials.Database
+	config.Params = parameters
+	return config.FormatDSN()
+}
+
+func (p *Provider) DatabaseExists(ctx context.Context, name string) (bool, error) {
+	var databaseExists bool
+	checkDatabaseError := p.dbConnection.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?)", name).Scan(&databaseExists)
+	return databaseExists, checkDatabaseError
+}
+
+// UserExists reports whether an account of the user exists for any host.
+func (p *Provider) UserExists(ctx context.Context, name string) (bool, error) {
+	hosts, listHostsError := p.listHosts(ctx, name)
+	return len(hosts) > 0, listHostsError
+}
+
 func (p *Provider) HealthCheck(ctx context.Context) error {
 	return p.dbConnection.PingContext(ctx)
 }
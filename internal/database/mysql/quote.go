@@ -0,0 +1,44 @@
+package mysql
+
+import (
+	"strings"
+)
+
+// quoteIdentifier quotes the name as a single identifier, e.g. a database or user name.
+// NUL bytes are removed, as they cannot be part of an identifier.
+func quoteIdentifier(name string) string {
+	return "`" + strings.NewReplacer("`", "``", "\x00", "").Replace(name) + "`"
+}
+
+// quoteAccount quotes the user name and host as account name, e.g. `user`@`10.0.%`.
+func quoteAccount(username, host string) string {
+	return quoteIdentifier(username) + "@" + quoteIdentifier(host)
+}
+
+var (
+	// backslashEscaper escapes all characters which are treated specially by the server within a string literal.
+	backslashEscaper = strings.NewReplacer(
+		"\x00", `\0`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\x1a", `\Z`,
+		`\`, `\\`,
+		`'`, `\'`,
+		`"`, `\"`,
+	)
+	// quoteEscaper is used if the NO_BACKSLASH_ESCAPES sql mode is active, which turns the backslash into a regular character.
+	quoteEscaper = strings.NewReplacer(`'`, `''`)
+)
+
+// quoteLiteral quotes the value as a string literal, honoring the NO_BACKSLASH_ESCAPES sql mode of the server.
+func quoteLiteral(value string, noBackslashEscapes bool) string {
+	if noBackslashEscapes {
+		return "'" + quoteEscaper.Replace(value) + "'"
+	}
+	return "'" + backslashEscaper.Replace(value) + "'"
+}
+
+// quoteLiteral quotes the value as a string literal matching the sql mode of the connected server.
+func (p *Provider) quoteLiteral(value string) string {
+	return quoteLiteral(value, p.noBackslashEscapes)
+}
@@ -0,0 +1,166 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var quoteSeeds = []string{
+	"",
+	"demo_database",
+	"it's",
+	`double"quote`,
+	`back\slash`,
+	"`backtick`",
+	"'; DROP DATABASE mysql; --",
+	"`; DROP DATABASE mysql; --",
+	`\'; SELECT 1; --`,
+	"new\nline\r\x1a",
+	"ünïcödé 🔑",
+	"nul\x00byte",
+}
+
+// scanIdentifier lexes a quoted identifier at the start of the input the way the server does.
+func scanIdentifier(input string) (value, rest string, ok bool) {
+	if !strings.HasPrefix(input, "`") {
+		return "", "", false
+	}
+	var builder strings.Builder
+	for i := 1; i < len(input); i++ {
+		if input[i] != '`' {
+			builder.WriteByte(input[i])
+			continue
+		}
+		if i+1 < len(input) && input[i+1] == '`' {
+			builder.WriteByte('`')
+			i++
+			continue
+		}
+		return builder.String(), input[i+1:], true
+	}
+	return "", "", false
+}
+
+// backslashSequences maps the escape sequences interpreted by the server to their values.
+var backslashSequences = map[byte]byte{'0': 0, '\'': '\'', '"': '"', 'b': '\b', 'n': '\n', 'r': '\r', 't': '\t', 'Z': 0x1a, '\\': '\\'}
+
+// scanLiteral lexes a string literal at the start of the input the way the server does in the given sql mode.
+func scanLiteral(input string, noBackslashEscapes bool) (value, rest string, ok bool) {
+	if !strings.HasPrefix(input, "'") {
+		return "", "", false
+	}
+	var builder strings.Builder
+	for i := 1; i < len(input); i++ {
+		switch {
+		case input[i] == '\\' && !noBackslashEscapes:
+			if i+1 >= len(input) {
+				return "", "", false
+			}
+			if unescaped, found := backslashSequences[input[i+1]]; found {
+				builder.WriteByte(unescaped)
+			} else if input[i+1] == '%' || input[i+1] == '_' {
+				// kept as is for pattern matching
+				builder.WriteString(input[i : i+2])
+			} else {
+				builder.WriteByte(input[i+1])
+			}
+			i++
+		case input[i] == '\'':
+			if i+1 < len(input) && input[i+1] == '\'' {
+				builder.WriteByte('\'')
+				i++
+				continue
+			}
+			return builder.String(), input[i+1:], true
+		default:
+			builder.WriteByte(input[i])
+		}
+	}
+	return "", "", false
+}
+
+func TestQuote(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		quote    func(string) string
+		input    string
+		expected string
+	}{
+		{name: "identifier", quote: quoteIdentifier, input: "foo_bar", expected: "`foo_bar`"},
+		{name: "identifier with backtick", quote: quoteIdentifier, input: "foo`bar", expected: "`foo``bar`"},
+		{name: "account", quote: func(s string) string { return quoteAccount(s, "10.0.%") }, input: "foo`bar", expected: "`foo``bar`@`10.0.%`"},
+		{name: "literal", quote: func(s string) string { return quoteLiteral(s, false) }, input: `it's\`, expected: `'it\'s\\'`},
+		{name: "literal without backslash escapes", quote: func(s string) string { return quoteLiteral(s, true) }, input: `it's\`, expected: `'it''s\'`},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, testCase.quote(testCase.input))
+		})
+	}
+}
+
+func FuzzQuoteIdentifier(f *testing.F) {
+	for _, seed := range quoteSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		value, rest, ok := scanIdentifier(quoteIdentifier(name))
+		assert.True(t, ok)
+		assert.Empty(t, rest)
+		assert.Equal(t, strings.ReplaceAll(name, "\x00", ""), value)
+	})
+}
+
+func FuzzQuoteLiteral(f *testing.F) {
+	for _, seed := range quoteSeeds {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+	f.Fuzz(func(t *testing.T, literal string, noBackslashEscapes bool) {
+		value, rest, ok := scanLiteral(quoteLiteral(literal, noBackslashEscapes), noBackslashEscapes)
+		assert.True(t, ok)
+		assert.Empty(t, rest)
+		assert.Equal(t, literal, value)
+	})
+}
+
+func FuzzApplyAccountStatement(f *testing.F) {
+	for _, name := range quoteSeeds {
+		for _, password := range quoteSeeds {
+			f.Add(name, "%", password, false, false)
+			f.Add(name, "%", password, true, false)
+		}
+	}
+	f.Fuzz(func(t *testing.T, name, host, password string, accountExists, noBackslashEscapes bool) {
+		provider := &Provider{noBackslashEscapes: noBackslashEscapes}
+		statement := provider.applyAccountStatement(name, host, password, accountExists)
+
+		prefix, suffix := "CREATE USER IF NOT EXISTS ", ""
+		if accountExists {
+			prefix, suffix = "ALTER USER ", " ACCOUNT UNLOCK"
+		}
+		rest, found := strings.CutPrefix(statement, prefix)
+		assert.True(t, found)
+		parsedName, rest, ok := scanIdentifier(rest)
+		assert.True(t, ok)
+		assert.Equal(t, strings.ReplaceAll(name, "\x00", ""), parsedName)
+
+		rest, found = strings.CutPrefix(rest, "@")
+		assert.True(t, found)
+		parsedHost, rest, ok := scanIdentifier(rest)
+		assert.True(t, ok)
+		assert.Equal(t, strings.ReplaceAll(host, "\x00", ""), parsedHost)
+
+		if !accountExists && password == "" {
+			assert.Equal(t, " ACCOUNT LOCK", rest)
+			return
+		}
+		rest, found = strings.CutPrefix(rest, " IDENTIFIED BY ")
+		assert.True(t, found)
+		parsedPassword, rest, ok := scanLiteral(rest, noBackslashEscapes)
+		assert.True(t, ok)
+		assert.Equal(t, password, parsedPassword)
+		assert.Equal(t, suffix, rest)
+	})
+}
@@ -0,0 +1,16 @@
+package mysql
+
+import (
+	"context"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+)
+
+// ApplySchemas rejects any schema options, as mysql treats schemas as databases.
+func (p *Provider) ApplySchemas(ctx context.Context, options database.SchemaOptions) error {
+	if len(options.Schemas) > 0 || options.RevokePublicCreate || len(options.SearchPaths) > 0 {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "mysql", Option: "schemas"})
+	}
+	return nil
+}
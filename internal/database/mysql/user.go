@@ -0,0 +1,48 @@
+package mysql
+
+import (
+	"context"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+)
+
+// profilePrivileges lists the privileges granted on the database for the profiles without ownership. Privileges on
+// the database cover tables created later on as well.
+var profilePrivileges = map[database.UserProfile][]string{
+	database.UserProfileReadWrite: {"SELECT", "INSERT", "UPDATE", "DELETE"},
+	database.UserProfileReadOnly:  {"SELECT"},
+}
+
+func (p *Provider) ApplyUser(ctx context.Context, options database.UserOptions) error {
+	privileges, knownProfile := profilePrivileges[options.Profile]
+	if options.Profile == database.UserProfileOwner {
+		var normalizeError error
+		if privileges, normalizeError = normalizePrivileges(options.Privileges); normalizeError != nil {
+			return normalizeError
+		}
+	} else if !knownProfile {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "mysql", Option: "profile " + string(options.Profile)})
+	}
+	hosts, normalizeError := normalizeHosts(options.AllowedHosts)
+	if normalizeError != nil {
+		return normalizeError
+	}
+	if verifyError := verifyLimits(options.Limits); verifyError != nil {
+		return verifyError
+	}
+
+	if applyUserError := p.applyUser(ctx, options.Username, options.Password, hosts, options.Reporter); applyUserError != nil {
+		return classifyError(applyUserError)
+	}
+	if applyLimitsError := p.applyLimits(ctx, options.Username, hosts, options.Limits, options.Reporter); applyLimitsError != nil {
+		return classifyError(applyLimitsError)
+	}
+
+	// the grants are reconciled as a whole, which revokes the privileges of a previous profile as well
+	return classifyError(p.reconcileGrants(ctx, options.Name, options.Username, hosts, privileges, options.Reporter))
+}
+
+func (p *Provider) DestroyUser(ctx context.Context, options database.UserOptions) error {
+	return classifyError(p.dropUser(ctx, options.Username, options.Reporter))
+}
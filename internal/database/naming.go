@@ -0,0 +1,67 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// NamingRules describes the identifier limits of a database server.
+type NamingRules struct {
+	MaxDatabaseNameLength int
+	MaxUserNameLength     int
+	// ReservedDatabaseNames and ReservedUserNames belong to the server itself and must never be handed out to a resource.
+	ReservedDatabaseNames []string
+	ReservedUserNames     []string
+}
+
+// identifierPattern restricts the characters of managed identifiers to a set every supported server handles alike.
+var identifierPattern = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+
+// nameHashLength is the number of hex characters of the hash suffix added to shortened names.
+const nameHashLength = 8
+
+type ErrInvalidName struct {
+	Kind   string
+	Name   string
+	Reason string
+}
+
+func (e ErrInvalidName) Error() string {
+	return fmt.Sprintf("invalid %s name %q: %s", e.Kind, e.Name, e.Reason)
+}
+
+func (r NamingRules) ValidateDatabaseName(name string) error {
+	return validateName("database", name, r.MaxDatabaseNameLength, r.ReservedDatabaseNames)
+}
+
+func (r NamingRules) ValidateUserName(name string) error {
+	return validateName("user", name, r.MaxUserNameLength, r.ReservedUserNames)
+}
+
+func validateName(kind, name string, maxLength int, reservedNames []string) error {
+	if !identifierPattern.MatchString(name) {
+		return ErrInvalidName{Kind: kind, Name: name, Reason: "only letters, digits and underscores are allowed"}
+	}
+	if len(name) > maxLength {
+		return ErrInvalidName{Kind: kind, Name: name, Reason: fmt.Sprintf("must not be longer than %d characters", maxLength)}
+	}
+	if slices.ContainsFunc(reservedNames, func(reservedName string) bool { return strings.EqualFold(reservedName, name) }) {
+		return ErrInvalidName{Kind: kind, Name: name, Reason: "reserved by the database server"}
+	}
+	return nil
+}
+
+// ShortenName truncates names exceeding the maximum length and appends a hash of the full name.
+// The result is stable, so the same input always maps to the same name.
+func ShortenName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	hash := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(hash[:])[:nameHashLength]
+	return name[:max(maxLength-len(suffix), 0)] + suffix
+}
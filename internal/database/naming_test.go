@@ -0,0 +1,56 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShortenName(t *testing.T) {
+	longName := strings.Repeat("a", 70)
+	for _, testCase := range []struct {
+		name      string
+		input     string
+		maxLength int
+		expected  string
+	}{
+		{name: "short name unchanged", input: "foo_demo", maxLength: 63, expected: "foo_demo"},
+		{name: "exact length unchanged", input: strings.Repeat("a", 32), maxLength: 32, expected: strings.Repeat("a", 32)},
+		{name: "long name shortened", input: longName, maxLength: 32, expected: strings.Repeat("a", 23) + "_6bd5e503"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := ShortenName(testCase.input, testCase.maxLength)
+			assert.Equal(t, testCase.expected, actual)
+			assert.LessOrEqual(t, len(actual), testCase.maxLength)
+		})
+	}
+
+	t.Run("distinct names with same prefix", func(t *testing.T) {
+		assert.NotEqual(t, ShortenName(longName+"_x", 32), ShortenName(longName+"_y", 32))
+	})
+}
+
+func TestNamingRules_Validate(t *testing.T) {
+	rules := NamingRules{MaxDatabaseNameLength: 10, MaxUserNameLength: 5, ReservedUserNames: []string{"root"}}
+	for _, testCase := range []struct {
+		name    string
+		input   string
+		isValid bool
+	}{
+		{name: "valid", input: "foo_1", isValid: true},
+		{name: "empty", input: "", isValid: false},
+		{name: "illegal character", input: "foo-1", isValid: false},
+		{name: "too long", input: "foo_123", isValid: false},
+		{name: "reserved", input: "ROOT", isValid: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			validationError := rules.ValidateUserName(testCase.input)
+			if testCase.isValid {
+				assert.NoError(t, validationError)
+			} else {
+				assert.Error(t, validationError)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// PoolSettings shape the pool of connections a provider keeps to the database server. Zero values keep the defaults
+// of the provider, set values take precedence over the pool parameters of the dsn.
+type PoolSettings struct {
+	// MaxConnections limits the number of open connections.
+	MaxConnections int
+	// ConnectionLifetime is the age after which a connection is closed and replaced by a new one.
+	ConnectionLifetime time.Duration
+	// HealthCheckInterval is the interval in which idle connections are checked (postgres). MySQL connections are
+	// checked whenever they are taken from the pool.
+	HealthCheckInterval time.Duration
+}
+
+// Validate rejects settings, which cannot be passed on to the drivers.
+func (s PoolSettings) Validate() error {
+	switch {
+	case s.MaxConnections < 0 || s.MaxConnections > math.MaxInt32:
+		return fmt.Errorf("invalid maximum number of connections: %d", s.MaxConnections)
+	case s.ConnectionLifetime < 0:
+		return fmt.Errorf("invalid connection lifetime: %s", s.ConnectionLifetime)
+	case s.HealthCheckInterval < 0:
+		return fmt.Errorf("invalid health check interval: %s", s.HealthCheckInterval)
+	}
+	return nil
+}
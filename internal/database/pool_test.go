@@ -0,0 +1,33 @@
+package database
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolSettingsValidate(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		settings    PoolSettings
+		expectError bool
+	}{
+		{name: "provider defaults", settings: PoolSettings{}},
+		{name: "all settings", settings: PoolSettings{MaxConnections: 20, ConnectionLifetime: time.Hour, HealthCheckInterval: time.Minute}},
+		{name: "negative connections", settings: PoolSettings{MaxConnections: -1}, expectError: true},
+		{name: "too many connections", settings: PoolSettings{MaxConnections: math.MaxInt32 + 1}, expectError: true},
+		{name: "negative lifetime", settings: PoolSettings{ConnectionLifetime: -time.Second}, expectError: true},
+		{name: "negative health check interval", settings: PoolSettings{HealthCheckInterval: -time.Second}, expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			validateError := testCase.settings.Validate()
+			if testCase.expectError {
+				assert.Error(t, validateError)
+				return
+			}
+			assert.NoError(t, validateError)
+		})
+	}
+}
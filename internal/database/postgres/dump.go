@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+)
+
+// dumpEnvironmentVariables maps the connection settings of the dsn to the environment variables of pg_dump. Settings of
+// the connection pool are not passed on, as they are unknown to pg_dump.
+var dumpEnvironmentVariables = map[string]string{
+	"host":                 "PGHOST",
+	"hostaddr":             "PGHOSTADDR",
+	"port":                 "PGPORT",
+	"user":                 "PGUSER",
+	"password":             "PGPASSWORD",
+	"sslmode":              "PGSSLMODE",
+	"sslrootcert":          "PGSSLROOTCERT",
+	"sslcert":              "PGSSLCERT",
+	"sslkey":               "PGSSLKEY",
+	"connect_timeout":      "PGCONNECT_TIMEOUT",
+	"target_session_attrs": "PGTARGETSESSIONATTRS",
+}
+
+// Dump writes a plain sql dump of the database with pg_dump. Ownership and privileges are left out, as the users of
+// the database are dropped along with it, so the dump can be restored by any user.
+func (p *Provider) Dump(ctx context.Context, name string, w io.Writer) error {
+	environment, parseError := dumpEnvironment(p.dsn, name)
+	if parseError != nil {
+		return helper.Permanent(parseError)
+	}
+	return database.RunDump(ctx, w, environment, "pg_dump", "--no-owner", "--no-privileges")
+}
+
+// dumpEnvironment passes the connection settings of the dsn to pg_dump, connecting it to the given database.
+func dumpEnvironment(dsn, name string) ([]string, error) {
+	settings, parseError := parseConnectionSettings(dsn)
+	if parseError != nil {
+		return nil, parseError
+	}
+
+	environment := []string{"PGDATABASE=" + name}
+	for setting, variable := range dumpEnvironmentVariables {
+		if value, found := settings[setting]; found {
+			environment = append(environment, variable+"="+value)
+		}
+	}
+	return environment, nil
+}
+
+// parseConnectionSettings parses a dsn given either as url or as keyword/value connection string.
+func parseConnectionSettings(dsn string) (map[string]string, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return parseKeywordValues(dsn)
+	}
+
+	uri, parseError := url.Parse(dsn)
+	if parseError != nil {
+		return nil, fmt.Errorf("invalid dsn: %w", parseError)
+	}
+	settings := map[string]string{}
+	for key, values := range uri.Query() {
+		settings[key] = values[0]
+	}
+	if hostname := uri.Hostname(); hostname != "" {
+		settings["host"] = hostname
+	}
+	if port := uri.Port(); port != "" {
+		settings["port"] = port
+	}
+	if uri.User != nil {
+		settings["user"] = uri.User.Username()
+		if password, found := uri.User.Password(); found {
+			settings["password"] = password
+		}
+	}
+	return settings, nil
+}
+
+// parseKeywordValues parses a connection string of keyword=value pairs separated by whitespace. Values may be enclosed
+// in single quotes and contain backslash escapes.
+func parseKeywordValues(dsn string) (map[string]string, error) {
+	settings := map[string]string{}
+	for remaining := strings.TrimSpace(dsn); remaining != ""; remaining = strings.TrimSpace(remaining) {
+		keyword, rest, found := strings.Cut(remaining, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid dsn: missing value of %q", remaining)
+		}
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		quoted := strings.HasPrefix(rest, "'")
+		if quoted {
+			rest = rest[1:]
+		}
+
+		var value strings.Builder
+		position := 0
+		for ; position < len(rest); position++ {
+			character := rest[position]
+			if character == '\\' && position+1 < len(rest) {
+				position++
+				value.WriteByte(rest[position])
+				continue
+			}
+			if quoted && character == '\'' || !quoted && unicode.IsSpace(rune(character)) {
+				break
+			}
+			value.WriteByte(character)
+		}
+		if quoted {
+			if position == len(rest) {
+				return nil, fmt.Errorf("invalid dsn: unterminated quote in value of %s", strings.TrimSpace(keyword))
+			}
+			position++
+		}
+
+		settings[strings.TrimSpace(keyword)] = value.String()
+		remaining = rest[position:]
+	}
+	return settings, nil
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"external-db-operator/internal/helper"
+)
+
+const (
+	// connectionAttempts limits how often an operation is attempted, if the connection to the server gets lost.
+	connectionAttempts   = 3
+	connectionRetryDelay = time.Second
+)
+
+// connectionErrorCodes are the SQLSTATE codes of a server shutting down or not yet accepting connections.
+var connectionErrorCodes = []string{"57P01", "57P02", "57P03"}
+
+// permanentErrorClasses lists the SQLSTATE classes which indicate a problem with the request itself.
+// Retrying a statement failing with one of those classes will not succeed without a change to the resource.
+var permanentErrorClasses = map[string]bool{
+	"0A": true, // feature not supported
+	"22": true, // data exception
+	"28": true, // invalid authorization specification
+}
+
+// permanentErrorCodes lists the SQLSTATE codes of class 42 (syntax error or access rule violation) which indicate a
+// problem with the request itself. Others, like undefined_object or undefined_table, may be caused by objects created
+// or dropped concurrently and succeed on a retry.
+var permanentErrorCodes = map[string]bool{
+	"42501": true, // insufficient_privilege
+	"42601": true, // syntax_error
+	"42602": true, // invalid_name
+	"42622": true, // name_too_long
+	"42939": true, // reserved_name
+}
+
+// classifyError marks errors reported by the server as permanent, if retrying the statement is pointless.
+func classifyError(err error) error {
+	var pgError *pgconn.PgError
+	if errors.As(err, &pgError) && (permanentErrorCodes[pgError.Code] || len(pgError.Code) >= 2 && permanentErrorClasses[pgError.Code[:2]]) {
+		return helper.Permanent(err)
+	}
+	return err
+}
+
+// isConnectionError reports whether the error is caused by a lost connection to the server, e.g. on a restart or
+// failover. The pool replaces broken connections, so the operation succeeds on a retry.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgError *pgconn.PgError
+	if errors.As(err, &pgError) {
+		// class 08 covers connection exceptions
+		return strings.HasPrefix(pgError.Code, "08") || slices.Contains(connectionErrorCodes, pgError.Code)
+	}
+	var netError net.Error
+	return pgconn.SafeToRetry(err) || errors.As(err, &netError) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryOnConnectionError runs the idempotent operation again, as long as it fails because of a lost connection and
+// the context is not done.
+func retryOnConnectionError(ctx context.Context, operation func() error) error {
+	operationError := operation()
+	for attempt := 1; attempt < connectionAttempts && isConnectionError(operationError) && ctx.Err() == nil; attempt++ {
+		slog.Warn("lost connection to database server, retrying", slog.Int("attempt", attempt), slog.String("error", operationError.Error()))
+		select {
+		case <-ctx.Done():
+			return operationError
+		case <-time.After(time.Duration(attempt) * connectionRetryDelay):
+		}
+		operationError = operation()
+	}
+	return operationError
+}
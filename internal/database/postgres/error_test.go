@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+
+	"external-db-operator/internal/helper"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, testCase := range []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{name: "syntax error", err: &pgconn.PgError{Code: "42601"}, permanent: true},
+		{name: "insufficient privilege", err: fmt.Errorf("failed to grant: %w", &pgconn.PgError{Code: "42501"}), permanent: true},
+		{name: "invalid parameter value", err: &pgconn.PgError{Code: "22023"}, permanent: true},
+		{name: "feature not supported", err: &pgconn.PgError{Code: "0A000"}, permanent: true},
+		{name: "undefined object", err: &pgconn.PgError{Code: "42704"}, permanent: false},
+		{name: "undefined table", err: &pgconn.PgError{Code: "42P01"}, permanent: false},
+		{name: "duplicate object", err: &pgconn.PgError{Code: "42710"}, permanent: false},
+		{name: "connection exception", err: &pgconn.PgError{Code: "08006"}, permanent: false},
+		{name: "other error", err: errors.New("unexpected"), permanent: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.permanent, helper.IsPermanentError(classifyError(testCase.err)))
+		})
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "no error", err: nil, expected: false},
+		{name: "connection exception", err: &pgconn.PgError{Code: "08006"}, expected: true},
+		{name: "admin shutdown", err: fmt.Errorf("failed to create database: %w", &pgconn.PgError{Code: "57P01"}), expected: true},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, expected: true},
+		{name: "syntax error", err: helper.Permanent(&pgconn.PgError{Code: "42601"}), expected: false},
+		{name: "other error", err: errors.New("role does not exist"), expected: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, isConnectionError(testCase.err))
+		})
+	}
+}
+
+func TestRetryOnConnectionError(t *testing.T) {
+	var attempts int
+	retryError := retryOnConnectionError(context.Background(), func() error {
+		attempts++
+		if attempts == 1 {
+			return &pgconn.PgError{Code: "57P01"}
+		}
+		return nil
+	})
+	assert.NoError(t, retryError)
+	assert.Equal(t, 2, attempts)
+
+	attempts = 0
+	retryError = retryOnConnectionError(context.Background(), func() error {
+		attempts++
+		return &pgconn.PgError{Code: "42601"}
+	})
+	assert.Error(t, retryError)
+	assert.Equal(t, 1, attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	retryError = retryOnConnectionError(ctx, func() error {
+		attempts++
+		return &pgconn.PgError{Code: "57P01"}
+	})
+	assert.Error(t, retryError)
+	assert.Equal(t, 1, attempts)
+}
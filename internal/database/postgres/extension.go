@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"external-db-operator/internal/database"
+)
+
+// applyExtensions installs the extensions into the database and updates them on version changes, the dropped
+// extensions are removed. Installing extensions usually requires superuser privileges, so they are managed with the
+// connection of the operator instead of the owner.
+func (p *Provider) applyExtensions(ctx context.Context, options database.CreateOptions) error {
+	if len(options.Extensions) == 0 && len(options.DroppedExtensions) == 0 {
+		return nil
+	}
+
+	return p.inDatabase(ctx, options.Name, func(connection *pgx.Conn) error {
+		for _, extension := range options.Extensions {
+			var installedVersion string
+			queryError := connection.QueryRow(ctx, "SELECT extversion FROM pg_extension WHERE extname = $1", extension.Name).Scan(&installedVersion)
+
+			var statement string
+			switch {
+			case errors.Is(queryError, pgx.ErrNoRows):
+				options.Reporter.Report("CreatingExtension", "create extension", extension.Name)
+				statement = "CREATE EXTENSION IF NOT EXISTS " + quoteIdentifier(extension.Name)
+				if extension.Version != "" {
+					statement += " VERSION " + quoteLiteral(extension.Version)
+				}
+			case queryError != nil:
+				return queryError
+			case extension.Version != "" && extension.Version != installedVersion:
+				options.Reporter.Report("UpdatingExtension", "update extension to version "+extension.Version, extension.Name)
+				statement = fmt.Sprintf("ALTER EXTENSION %s UPDATE TO %s", quoteIdentifier(extension.Name), quoteLiteral(extension.Version))
+			default:
+				continue
+			}
+			if _, applyExtensionError := connection.Exec(ctx, statement); applyExtensionError != nil {
+				return applyExtensionError
+			}
+		}
+
+		for _, name := range options.DroppedExtensions {
+			options.Reporter.Report("DroppingExtension", "drop extension", name)
+			if _, dropExtensionError := connection.Exec(ctx, "DROP EXTENSION IF EXISTS "+quoteIdentifier(name)); dropExtensionError != nil {
+				return dropExtensionError
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+)
+
+// verifyLimits rejects limits postgres is not able to enforce.
+func verifyLimits(limits database.Limits) error {
+	for option, value := range map[string]int{"maxQueriesPerHour": limits.MaxQueriesPerHour, "maxUpdatesPerHour": limits.MaxUpdatesPerHour, "maxConnectionsPerHour": limits.MaxConnectionsPerHour} {
+		if value != 0 {
+			return helper.Permanent(database.ErrUnsupportedOption{Provider: "postgres", Option: option})
+		}
+	}
+	return nil
+}
+
+// applyLimits sets the connection limit and the timeouts of the role, if they differ from the current ones.
+// Timeouts are role level settings, which take effect on the next login.
+func (p *Provider) applyLimits(ctx context.Context, username string, limits database.Limits, reporter database.Reporter) error {
+	var connectionLimit int
+	var settings []string
+	if queryError := p.dbConnection.QueryRow(ctx, "SELECT rolconnlimit, COALESCE(rolconfig, '{}') FROM pg_roles WHERE rolname = $1", username).Scan(&connectionLimit, &settings); queryError != nil {
+		return queryError
+	}
+
+	// -1 lifts the limit, while 0 refuses all connections
+	requestedConnectionLimit := limits.ConnectionLimit
+	if requestedConnectionLimit == 0 {
+		requestedConnectionLimit = -1
+	}
+	if connectionLimit != requestedConnectionLimit {
+		reporter.Report("ApplyingLimits", "apply connection limit "+strconv.Itoa(requestedConnectionLimit)+" to user", username)
+		if _, alterRoleError := p.dbConnection.Exec(ctx, fmt.Sprintf("ALTER ROLE %s CONNECTION LIMIT %d", quoteIdentifier(username), requestedConnectionLimit)); alterRoleError != nil {
+			return alterRoleError
+		}
+	}
+
+	for _, timeout := range []struct {
+		setting string
+		value   time.Duration
+	}{
+		{setting: "statement_timeout", value: limits.StatementTimeout},
+		{setting: "idle_in_transaction_session_timeout", value: limits.IdleInTransactionSessionTimeout},
+	} {
+		current, isSet := roleSetting(settings, timeout.setting)
+		var statement string
+		switch requested := timeoutMilliseconds(timeout.value); {
+		case timeout.value == 0 && isSet:
+			reporter.Report("ApplyingLimits", "reset "+timeout.setting+" of user", username)
+			statement = fmt.Sprintf("ALTER ROLE %s RESET %s", quoteIdentifier(username), timeout.setting)
+		case timeout.value != 0 && current != requested:
+			reporter.Report("ApplyingLimits", "apply "+timeout.setting+" "+requested+"ms to user", username)
+			statement = fmt.Sprintf("ALTER ROLE %s SET %s = %s", quoteIdentifier(username), timeout.setting, requested)
+		default:
+			continue
+		}
+		if _, alterRoleError := p.dbConnection.Exec(ctx, statement); alterRoleError != nil {
+			return alterRoleError
+		}
+	}
+
+	return nil
+}
+
+// roleSetting looks up the value of a setting within the role level settings, given as name=value.
+func roleSetting(settings []string, name string) (string, bool) {
+	for _, setting := range settings {
+		if value, found := strings.CutPrefix(setting, name+"="); found {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// timeoutMilliseconds formats the timeout in milliseconds, the default unit of the timeout settings.
+// Timeouts below one millisecond are rounded up, as zero disables the timeout.
+func timeoutMilliseconds(timeout time.Duration) string {
+	return strconv.FormatInt(max(timeout.Milliseconds(), 1), 10)
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleSetting(t *testing.T) {
+	settings := []string{"role=foo_bar", "statement_timeout=30000"}
+	for _, testCase := range []struct {
+		name          string
+		setting       string
+		expected      string
+		expectedIsSet bool
+	}{
+		{name: "set", setting: "statement_timeout", expected: "30000", expectedIsSet: true},
+		{name: "not set", setting: "idle_in_transaction_session_timeout"},
+		{name: "prefix of another setting", setting: "statement", expectedIsSet: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, isSet := roleSetting(settings, testCase.setting)
+			assert.Equal(t, testCase.expected, actual)
+			assert.Equal(t, testCase.expectedIsSet, isSet)
+		})
+	}
+}
+
+func TestTimeoutMilliseconds(t *testing.T) {
+	assert.Equal(t, "30000", timeoutMilliseconds(30*time.Second))
+	assert.Equal(t, "1", timeoutMilliseconds(time.Microsecond))
+}
@@ -3,31 +3,41 @@ package postgres
 import (
 	"context"
 	"fmt"
-	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"external-db-operator/internal/database"
 	"external-db-operator/internal/helper"
+	"external-db-operator/internal/password"
 )
 
 func init() {
 	database.RegisterProvider("postgres", Provide)
 }
 
-func Provide() database.Provider {
-	return &Provider{}
+func Provide(pool database.PoolSettings) database.Provider {
+	return &Provider{pool: pool}
 }
 
 type Provider struct {
-	dsn          string
-	dbConnection *pgx.Conn
+	dsn  string
+	pool database.PoolSettings
+	// dbConnection is a pool of connections to the maintenance database, replacing broken connections on their own.
+	dbConnection *pgxpool.Pool
+	// passwordRequirements are enforced by the passwordcheck module of the server, if loaded.
+	passwordRequirements password.Requirements
 }
 
 var _ database.Provider = &Provider{}
 
-func (p *Provider) GetConnectionInfo() (database.ConnectionInfo, error) {
-	conn, dsnParseError := pgx.ParseConfig(p.dsn)
+func (p *Provider) GetConnectionInfo(_ context.Context) (database.ConnectionInfo, error) {
+	conn, dsnParseError := p.connectionConfig()
 	if dsnParseError != nil {
 		return database.ConnectionInfo{}, dsnParseError
 	}
@@ -37,68 +47,365 @@ func (p *Provider) GetConnectionInfo() (database.ConnectionInfo, error) {
 	}, nil
 }
 
-func (p *Provider) Apply(options database.CreateOptions) error {
-	slog.Info("creating database", slog.String("name", options.Name))
-	_, createDatabaseError := p.dbConnection.Exec(context.Background(), fmt.Sprintf("CREATE DATABASE %q", options.Name))
-	if createDatabaseError != nil && !helper.IsAlreadyExistsError(createDatabaseError) {
-		return createDatabaseError
+func (p *Provider) ConnectionStrings(credentials database.Credentials) database.ConnectionStrings {
+	address := net.JoinHostPort(credentials.Host, strconv.Itoa(int(credentials.Port)))
+	uri := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(credentials.Username, credentials.Password),
+		Host:   address,
+		Path:   "/" + credentials.Database,
 	}
+	jdbcParameters := url.Values{"user": {credentials.Username}, "password": {credentials.Password}}
 
-	var userExists bool
-	if checkUserError := p.dbConnection.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", options.Name).Scan(&userExists); checkUserError != nil {
-		return checkUserError
+	return database.ConnectionStrings{
+		URI:     uri.String(),
+		JDBCURL: "jdbc:postgresql://" + address + "/" + url.PathEscape(credentials.Database) + "?" + jdbcParameters.Encode(),
+		DotNetConnectionString: database.FormatDotNetConnectionString([][2]string{
+			{"Host", credentials.Host},
+			{"Port", strconv.Itoa(int(credentials.Port))},
+			{"Database", credentials.Database},
+			{"Username", credentials.Username},
+			{"Password", credentials.Password},
+		}),
+	}
+}
+
+func (p *Provider) FormatDSN(credentials database.Credentials, parameters map[string]string) string {
+	query := url.Values{}
+	for key, value := range parameters {
+		query.Set(key, value)
+	}
+	uri := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(credentials.Username, credentials.Password),
+		Host:     net.JoinHostPort(credentials.Host, strconv.Itoa(int(credentials.Port))),
+		Path:     "/" + credentials.Database,
+		RawQuery: query.Encode(),
+	}
+	return uri.String()
+}
+
+func (p *Provider) Apply(ctx context.Context, options database.CreateOptions) error {
+	return retryOnConnectionError(ctx, func() error { return p.apply(ctx, options) })
+}
+
+func (p *Provider) apply(ctx context.Context, options database.CreateOptions) error {
+	if options.Charset != "" {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "postgres", Option: "charset"})
+	}
+	// the owner of a database holds all privileges on it
+	if len(options.Privileges) > 0 {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "postgres", Option: "privileges"})
+	}
+	if len(options.AllowedHosts) > 0 {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "postgres", Option: "allowedHosts"})
+	}
+	if verifyError := verifyLimits(options.Limits); verifyError != nil {
+		return verifyError
 	}
 
-	if userExists {
-		slog.Info("alter user", slog.String("name", options.Name))
-		_, updateUserError := p.dbConnection.Exec(context.Background(), fmt.Sprintf("ALTER USER %s WITH PASSWORD '%s'", options.Name, options.Password))
-		if updateUserError != nil {
-			return updateUserError
+	databaseExists, checkDatabaseError := p.DatabaseExists(ctx, options.Name)
+	if checkDatabaseError != nil {
+		return classifyError(checkDatabaseError)
+	}
+	if !databaseExists {
+		options.Reporter.Report("CreatingDatabase", "creating database", options.Name)
+		_, createDatabaseError := p.dbConnection.Exec(ctx, createDatabaseStatement(options))
+		if createDatabaseError != nil && !helper.IsAlreadyExistsError(createDatabaseError) {
+			return classifyError(createDatabaseError)
 		}
-	} else {
-		slog.Info("create user", slog.String("name", options.Name))
-		_, createUserError := p.dbConnection.Exec(context.Background(), fmt.Sprintf("CREATE USER %s WITH PASSWORD '%s'", options.Name, options.Password))
-		if createUserError != nil {
-			return createUserError
+	}
+	if verifyError := p.verifyDatabaseProperties(ctx, options); verifyError != nil {
+		return classifyError(verifyError)
+	}
+
+	if applyUserError := p.applyUser(ctx, options.Username, options.Password, options.Reporter); applyUserError != nil {
+		return classifyError(applyUserError)
+	}
+	if applyLimitsError := p.applyLimits(ctx, options.Username, options.Limits, options.Reporter); applyLimitsError != nil {
+		return classifyError(applyLimitsError)
+	}
+
+	if applyOwnerError := p.applyDatabaseOwner(ctx, options); applyOwnerError != nil {
+		return classifyError(applyOwnerError)
+	}
+
+	if applyExtensionsError := p.applyExtensions(ctx, options); applyExtensionsError != nil {
+		return classifyError(applyExtensionsError)
+	}
+
+	for _, login := range options.Logins {
+		if applyLoginError := p.applyLogin(ctx, options.Username, login, options.Reporter); applyLoginError != nil {
+			return classifyError(applyLoginError)
+		}
+		// settings of the owner do not apply to its members, so every login is limited on its own
+		if applyLimitsError := p.applyLimits(ctx, login.Username, options.Limits, options.Reporter); applyLimitsError != nil {
+			return classifyError(applyLimitsError)
 		}
 	}
 
-	slog.Info("apply database ownership", slog.String("name", options.Name))
-	_, grantUserError := p.dbConnection.Exec(context.Background(), fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", options.Name, options.Name))
-	if grantUserError != nil {
-		return grantUserError
+	return nil
+}
+
+// applyUser creates or updates the user. An empty password keeps the current one, new users are created without login.
+func (p *Provider) applyUser(ctx context.Context, username, password string, reporter database.Reporter) error {
+	userExists, checkUserError := p.UserExists(ctx, username)
+	if checkUserError != nil {
+		return checkUserError
+	}
+
+	switch {
+	case userExists && password == "":
+		return nil
+	case userExists:
+		// the password cannot be read back, so it is set again on every reconciliation
+		reporter.Enforce("alter user", username)
+	default:
+		reporter.Report("CreatingUser", "create user", username)
+	}
+	_, applyUserError := p.dbConnection.Exec(ctx, applyUserStatement(username, password, userExists))
+	return applyUserError
+}
+
+// applyDatabaseOwner hands the database over to the user, if it is owned by another one.
+func (p *Provider) applyDatabaseOwner(ctx context.Context, options database.CreateOptions) error {
+	var currentOwner string
+	if queryError := p.dbConnection.QueryRow(ctx, "SELECT pg_get_userbyid(datdba) FROM pg_database WHERE datname = $1", options.Name).Scan(&currentOwner); queryError != nil {
+		return queryError
+	}
+	if currentOwner == options.Username {
+		return nil
+	}
+
+	options.Reporter.Report("ApplyingOwnership", "apply database ownership", options.Name)
+	_, alterDatabaseError := p.dbConnection.Exec(ctx, fmt.Sprintf("ALTER DATABASE %s OWNER TO %s", quoteIdentifier(options.Name), quoteIdentifier(options.Username)))
+	return alterDatabaseError
+}
+
+// applyUserStatement returns the statement creating the user or setting the password of the existing one.
+func applyUserStatement(username, password string, userExists bool) string {
+	switch {
+	case userExists:
+		return fmt.Sprintf("ALTER USER %s WITH LOGIN PASSWORD %s", quoteIdentifier(username), quoteLiteral(password))
+	case password == "":
+		return fmt.Sprintf("CREATE USER %s NOLOGIN", quoteIdentifier(username))
+	default:
+		return fmt.Sprintf("CREATE USER %s WITH PASSWORD %s", quoteIdentifier(username), quoteLiteral(password))
+	}
+}
+
+// applyLogin makes the login act on behalf of the owner, so both logins share all objects.
+func (p *Provider) applyLogin(ctx context.Context, owner string, login database.Login, reporter database.Reporter) error {
+	if applyUserError := p.applyUser(ctx, login.Username, login.Password, reporter); applyUserError != nil {
+		return applyUserError
+	}
+	return p.grantOwnerRole(ctx, owner, login.Username)
+}
+
+// grantOwnerRole makes the user a member of the owner, acting as the owner by default, so created objects belong to the owner.
+func (p *Provider) grantOwnerRole(ctx context.Context, owner, username string) error {
+	if _, grantRoleError := p.dbConnection.Exec(ctx, fmt.Sprintf("GRANT %s TO %s", quoteIdentifier(owner), quoteIdentifier(username))); grantRoleError != nil {
+		return grantRoleError
+	}
+	_, setRoleError := p.dbConnection.Exec(ctx, fmt.Sprintf("ALTER ROLE %s SET role = %s", quoteIdentifier(username), quoteLiteral(owner)))
+	return setRoleError
+}
+
+func createDatabaseStatement(options database.CreateOptions) string {
+	statement := "CREATE DATABASE " + quoteIdentifier(options.Name)
+
+	template := options.Template
+	if template == "" && (options.Encoding != "" || options.Locale != "" || options.Collation != "") {
+		// template1 may contain data depending on its encoding and locale, template0 is guaranteed to be pristine
+		template = "template0"
+	}
+	if template != "" {
+		statement += " TEMPLATE " + quoteIdentifier(template)
+	}
+	if options.Encoding != "" {
+		statement += " ENCODING " + quoteLiteral(options.Encoding)
+	}
+	if options.Locale != "" {
+		statement += " LOCALE " + quoteLiteral(options.Locale)
+	}
+	if options.Collation != "" {
+		statement += " LC_COLLATE " + quoteLiteral(options.Collation)
+	}
+
+	return statement
+}
+
+// verifyDatabaseProperties ensures the requested properties match the existing database, as they can only be set on creation.
+func (p *Provider) verifyDatabaseProperties(ctx context.Context, options database.CreateOptions) error {
+	if options.Encoding == "" && options.Locale == "" && options.Collation == "" {
+		return nil
+	}
+
+	var encoding, collation, ctype string
+	if queryError := p.dbConnection.QueryRow(ctx, "SELECT pg_encoding_to_char(encoding), datcollate, datctype FROM pg_database WHERE datname = $1", options.Name).Scan(&encoding, &collation, &ctype); queryError != nil {
+		return queryError
+	}
+
+	if options.Encoding != "" && !equalEncoding(options.Encoding, encoding) {
+		return helper.Permanent(database.ErrImmutableProperty{Property: "encoding", Current: encoding, Requested: options.Encoding})
+	}
+	if options.Locale != "" && options.Locale != ctype {
+		return helper.Permanent(database.ErrImmutableProperty{Property: "locale", Current: ctype, Requested: options.Locale})
+	}
+	requestedCollation := options.Collation
+	if requestedCollation == "" {
+		requestedCollation = options.Locale
+	}
+	if requestedCollation != "" && requestedCollation != collation {
+		return helper.Permanent(database.ErrImmutableProperty{Property: "collation", Current: collation, Requested: requestedCollation})
 	}
 
 	return nil
 }
 
-func (p *Provider) Destroy(options database.DestroyOptions) error {
-	slog.Info("destroying database", slog.String("name", options.Name))
-	_, dropDatabaseError := p.dbConnection.Exec(context.Background(), fmt.Sprintf("DROP DATABASE %q", options.Name))
+// equalEncoding compares encoding names the way the server resolves them, e.g. utf-8 matches UTF8.
+func equalEncoding(a, b string) bool {
+	normalize := strings.NewReplacer("-", "", "_", "")
+	return strings.EqualFold(normalize.Replace(a), normalize.Replace(b))
+}
+
+// NamingRules reflects the default NAMEDATALEN of 64 bytes, including the terminating zero byte.
+// The maintenance databases and the user of the operator itself are reserved.
+func (p *Provider) NamingRules() database.NamingRules {
+	reservedUserNames := []string{"postgres"}
+	if config, dsnParseError := p.connectionConfig(); dsnParseError == nil {
+		reservedUserNames = append(reservedUserNames, config.User)
+	}
+	return database.NamingRules{
+		MaxDatabaseNameLength: 63,
+		MaxUserNameLength:     63,
+		ReservedDatabaseNames: []string{"postgres", "template0", "template1"},
+		ReservedUserNames:     reservedUserNames,
+	}
+}
+
+func (p *Provider) Destroy(ctx context.Context, options database.DestroyOptions) error {
+	return retryOnConnectionError(ctx, func() error { return p.destroy(ctx, options) })
+}
+
+func (p *Provider) destroy(ctx context.Context, options database.DestroyOptions) error {
+	switch options.Policy {
+	case database.DeletionPolicyRetain:
+		if options.RevokeLogin {
+			for _, username := range options.Usernames() {
+				options.Reporter.Report("RevokingLogin", "revoking login", username)
+				_, revokeLoginError := p.dbConnection.Exec(ctx, fmt.Sprintf("ALTER USER %s NOLOGIN", quoteIdentifier(username)))
+				if revokeLoginError != nil && !helper.IsNotExistsError(revokeLoginError) {
+					return classifyError(revokeLoginError)
+				}
+			}
+		}
+		return nil
+	}
+
+	options.Reporter.Report("DestroyingDatabase", "destroying database", options.Name)
+	_, dropDatabaseError := p.dbConnection.Exec(ctx, fmt.Sprintf("DROP DATABASE %s", quoteIdentifier(options.Name)))
 	if dropDatabaseError != nil && !helper.IsNotExistsError(dropDatabaseError) {
-		return dropDatabaseError
+		return classifyError(dropDatabaseError)
 	}
-	slog.Info("destroying user", slog.String("name", options.Name))
-	_, dropUserError := p.dbConnection.Exec(context.Background(), fmt.Sprintf("DROP USER %q", options.Name))
-	if dropUserError != nil && !helper.IsNotExistsError(dropUserError) {
-		return dropUserError
+	for _, username := range options.Usernames() {
+		options.Reporter.Report("DestroyingUser", "destroying user", username)
+		_, dropUserError := p.dbConnection.Exec(ctx, fmt.Sprintf("DROP USER %s", quoteIdentifier(username)))
+		if dropUserError != nil && !helper.IsNotExistsError(dropUserError) {
+			return classifyError(dropUserError)
+		}
 	}
 
 	return nil
 }
 
-func (p *Provider) Initialize(dsn string) error {
+// connectTo opens a dedicated connection to the given database on the server, using the administrative credentials.
+func (p *Provider) connectTo(ctx context.Context, name string) (*pgx.Conn, error) {
+	config, dsnParseError := p.connectionConfig()
+	if dsnParseError != nil {
+		return nil, dsnParseError
+	}
+	config.Database = name
+
+	return pgx.ConnectConfig(ctx, config)
+}
+
+// connectionConfig parses the dsn without the parameters of the connection pool, which the server would reject.
+func (p *Provider) connectionConfig() (*pgx.ConnConfig, error) {
+	poolConfig, dsnParseError := pgxpool.ParseConfig(p.dsn)
+	if dsnParseError != nil {
+		return nil, dsnParseError
+	}
+	return poolConfig.ConnConfig, nil
+}
+
+// Initialize opens the connection pool. Its size, connection lifetime and health check interval are taken from the pool
+// settings of the provider, or else from the pool_max_conns, pool_max_conn_lifetime and pool_health_check_period
+// parameters of the dsn.
+func (p *Provider) Initialize(ctx context.Context, dsn string) error {
 	p.dsn = dsn
-	dbConnection, databaseConnectionError := pgx.Connect(context.Background(), dsn)
+	poolConfig, dsnParseError := p.poolConfig(dsn)
+	if dsnParseError != nil {
+		return dsnParseError
+	}
+	dbConnection, databaseConnectionError := pgxpool.NewWithConfig(ctx, poolConfig)
 	if databaseConnectionError != nil {
 		return databaseConnectionError
 	}
+	// the pool connects lazily, so the connection is verified up front
+	if pingError := dbConnection.Ping(ctx); pingError != nil {
+		dbConnection.Close()
+		return pingError
+	}
 	p.dbConnection = dbConnection
+
+	// compatible servers like CockroachDB do not know the setting, they are assumed to have no password requirements
+	var preloadLibraries string
+	if queryError := dbConnection.QueryRow(ctx, "SHOW shared_preload_libraries").Scan(&preloadLibraries); queryError == nil &&
+		slices.Contains(strings.Split(strings.ReplaceAll(preloadLibraries, " ", ""), ","), "passwordcheck") {
+		// passwordcheck demands eight characters, containing letters and non-letters
+		p.passwordRequirements = password.Requirements{MinLength: 8, MinLowercase: 1, MinDigits: 1}
+	}
 	return nil
 }
 
+// poolConfig parses the dsn, applying the pool settings of the provider on top of the pool parameters of the dsn.
+func (p *Provider) poolConfig(dsn string) (*pgxpool.Config, error) {
+	poolConfig, dsnParseError := pgxpool.ParseConfig(dsn)
+	if dsnParseError != nil {
+		return nil, dsnParseError
+	}
+	if p.pool.MaxConnections > 0 {
+		poolConfig.MaxConns = int32(p.pool.MaxConnections)
+	}
+	if p.pool.ConnectionLifetime > 0 {
+		poolConfig.MaxConnLifetime = p.pool.ConnectionLifetime
+	}
+	if p.pool.HealthCheckInterval > 0 {
+		poolConfig.HealthCheckPeriod = p.pool.HealthCheckInterval
+	}
+	return poolConfig, nil
+}
+
+func (p *Provider) PasswordRequirements() password.Requirements {
+	return p.passwordRequirements
+}
+
 func (p *Provider) Close() error {
-	return p.dbConnection.Close(context.Background())
+	p.dbConnection.Close()
+	return nil
+}
+
+func (p *Provider) DatabaseExists(ctx context.Context, name string) (bool, error) {
+	var databaseExists bool
+	checkDatabaseError := p.dbConnection.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", name).Scan(&databaseExists)
+	return databaseExists, checkDatabaseError
+}
+
+func (p *Provider) UserExists(ctx context.Context, name string) (bool, error) {
+	var userExists bool
+	checkUserError := p.dbConnection.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", name).Scan(&userExists)
+	return userExists, checkUserError
 }
 
 func (p *Provider) HealthCheck(ctx context.Context) error {
@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// quoteIdentifier quotes the name as a single identifier, e.g. a database or role name.
+// NUL bytes are removed, as they cannot be part of an identifier.
+func quoteIdentifier(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// literalEscaper doubles backslashes and single quotes, removing NUL bytes which cannot be part of a string constant.
+var literalEscaper = strings.NewReplacer(`\`, `\\`, `'`, `''`, "\x00", "")
+
+// quoteLiteral quotes the value as an escape string constant.
+// Escape strings are interpreted the same way regardless of the standard_conforming_strings setting of the server.
+func quoteLiteral(value string) string {
+	return `E'` + literalEscaper.Replace(value) + `'`
+}
@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var quoteSeeds = []string{
+	"",
+	"demo_database",
+	"it's",
+	`double"quote`,
+	`back\slash`,
+	`'; DROP DATABASE postgres; --`,
+	`"; DROP DATABASE postgres; --`,
+	`\'; SELECT 1; --`,
+	"$$; SELECT 1; $$",
+	"`backtick`",
+	"ünïcödé 🔑",
+	"nul\x00byte",
+}
+
+// scanIdentifier lexes a quoted identifier at the start of the input the way the server does.
+func scanIdentifier(input string) (value, rest string, ok bool) {
+	if !strings.HasPrefix(input, `"`) {
+		return "", "", false
+	}
+	var builder strings.Builder
+	for i := 1; i < len(input); i++ {
+		if input[i] != '"' {
+			builder.WriteByte(input[i])
+			continue
+		}
+		if i+1 < len(input) && input[i+1] == '"' {
+			builder.WriteByte('"')
+			i++
+			continue
+		}
+		return builder.String(), input[i+1:], true
+	}
+	return "", "", false
+}
+
+// scanEscapeString lexes an escape string constant at the start of the input the way the server does.
+// Escape sequences other than quote and backslash are rejected, as quoteLiteral never produces them.
+func scanEscapeString(input string) (value, rest string, ok bool) {
+	if !strings.HasPrefix(input, `E'`) {
+		return "", "", false
+	}
+	var builder strings.Builder
+	for i := 2; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			if i+1 >= len(input) || (input[i+1] != '\\' && input[i+1] != '\'') {
+				return "", "", false
+			}
+			builder.WriteByte(input[i+1])
+			i++
+		case '\'':
+			if i+1 < len(input) && input[i+1] == '\'' {
+				builder.WriteByte('\'')
+				i++
+				continue
+			}
+			return builder.String(), input[i+1:], true
+		default:
+			builder.WriteByte(input[i])
+		}
+	}
+	return "", "", false
+}
+
+func withoutNul(input string) string {
+	return strings.ReplaceAll(input, "\x00", "")
+}
+
+func TestQuote(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		quote    func(string) string
+		input    string
+		expected string
+	}{
+		{name: "identifier", quote: quoteIdentifier, input: "foo_bar", expected: `"foo_bar"`},
+		{name: "identifier with quote", quote: quoteIdentifier, input: `foo"bar`, expected: `"foo""bar"`},
+		{name: "literal", quote: quoteLiteral, input: "secret", expected: `E'secret'`},
+		{name: "literal with quote and backslash", quote: quoteLiteral, input: `it's\`, expected: `E'it''s\\'`},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, testCase.quote(testCase.input))
+		})
+	}
+}
+
+func FuzzQuoteIdentifier(f *testing.F) {
+	for _, seed := range quoteSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		value, rest, ok := scanIdentifier(quoteIdentifier(name))
+		assert.True(t, ok)
+		assert.Empty(t, rest)
+		assert.Equal(t, withoutNul(name), value)
+	})
+}
+
+func FuzzQuoteLiteral(f *testing.F) {
+	for _, seed := range quoteSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, literal string) {
+		value, rest, ok := scanEscapeString(quoteLiteral(literal))
+		assert.True(t, ok)
+		assert.Empty(t, rest)
+		assert.Equal(t, withoutNul(literal), value)
+	})
+}
+
+func FuzzApplyUserStatement(f *testing.F) {
+	for _, name := range quoteSeeds {
+		for _, password := range quoteSeeds {
+			f.Add(name, password, true)
+			f.Add(name, password, false)
+		}
+	}
+	f.Fuzz(func(t *testing.T, name, password string, userExists bool) {
+		statement := applyUserStatement(name, password, userExists)
+
+		prefix, passwordClause := "CREATE USER ", " WITH PASSWORD "
+		if userExists {
+			prefix, passwordClause = "ALTER USER ", " WITH LOGIN PASSWORD "
+		}
+		rest, found := strings.CutPrefix(statement, prefix)
+		assert.True(t, found)
+		parsedName, rest, ok := scanIdentifier(rest)
+		assert.True(t, ok)
+		assert.Equal(t, withoutNul(name), parsedName)
+
+		if !userExists && password == "" {
+			assert.Equal(t, " NOLOGIN", rest)
+			return
+		}
+		rest, found = strings.CutPrefix(rest, passwordClause)
+		assert.True(t, found)
+		parsedPassword, rest, ok := scanEscapeString(rest)
+		assert.True(t, ok)
+		assert.Equal(t, withoutNul(password), parsedPassword)
+		assert.Empty(t, rest)
+	})
+}
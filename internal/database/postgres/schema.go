@@ -0,0 +1,136 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"external-db-operator/internal/database"
+)
+
+func (p *Provider) ApplySchemas(ctx context.Context, options database.SchemaOptions) error {
+	if len(options.Schemas) > 0 || options.RevokePublicCreate {
+		applySchemasError := p.inDatabase(ctx, options.Name, func(connection *pgx.Conn) error {
+			for _, schema := range options.Schemas {
+				if applySchemaError := applySchema(ctx, connection, schema, options.Reporter); applySchemaError != nil {
+					return applySchemaError
+				}
+			}
+			if options.RevokePublicCreate {
+				return revokePublicCreate(ctx, connection, options.Reporter)
+			}
+			return nil
+		})
+		if applySchemasError != nil {
+			return classifyError(applySchemasError)
+		}
+	}
+
+	usernames := slices.Concat(options.Usernames, slices.Collect(maps.Keys(options.SearchPaths)))
+	slices.Sort(usernames)
+	for _, username := range slices.Compact(usernames) {
+		if searchPathError := p.applySearchPath(ctx, options.Name, username, options.SearchPaths[username], options.Reporter); searchPathError != nil {
+			return classifyError(searchPathError)
+		}
+	}
+	return nil
+}
+
+// applySchema creates the schema or hands it over to its owner. Schemas are created on behalf of the owner, so the
+// default privileges of the owner apply to them.
+func applySchema(ctx context.Context, connection *pgx.Conn, schema database.Schema, reporter database.Reporter) error {
+	var currentOwner string
+	queryError := connection.QueryRow(ctx, "SELECT pg_get_userbyid(nspowner) FROM pg_namespace WHERE nspname = $1", schema.Name).Scan(&currentOwner)
+
+	var statement string
+	switch {
+	case errors.Is(queryError, pgx.ErrNoRows):
+		reporter.Report("CreatingSchema", "create schema", schema.Name)
+		statement = fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s AUTHORIZATION %s", quoteIdentifier(schema.Name), quoteIdentifier(schema.Owner))
+	case queryError != nil:
+		return queryError
+	case currentOwner != schema.Owner:
+		reporter.Report("AlteringSchema", "change owner of schema to "+schema.Owner, schema.Name)
+		statement = fmt.Sprintf("ALTER SCHEMA %s OWNER TO %s", quoteIdentifier(schema.Name), quoteIdentifier(schema.Owner))
+	default:
+		return nil
+	}
+	_, applySchemaError := connection.Exec(ctx, statement)
+	return applySchemaError
+}
+
+// revokePublicCreate takes the CREATE privilege on the public schema away from all users, which is the default
+// since postgres 15 for new databases.
+func revokePublicCreate(ctx context.Context, connection *pgx.Conn, reporter database.Reporter) error {
+	var publicCreate bool
+	queryError := connection.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_namespace n, aclexplode(COALESCE(n.nspacl, acldefault('n', n.nspowner))) a WHERE n.nspname = 'public' AND a.grantee = 0 AND a.privilege_type = 'CREATE')").Scan(&publicCreate)
+	if queryError != nil || !publicCreate {
+		return queryError
+	}
+
+	reporter.Report("RevokingPrivileges", "revoke CREATE on schema public from", "PUBLIC")
+	_, revokeError := connection.Exec(ctx, "REVOKE CREATE ON SCHEMA public FROM PUBLIC")
+	return revokeError
+}
+
+// applySearchPath sets the search path of the user within the database, if it differs from the current one. Without
+// a search path, the one set before is reset to the default.
+func (p *Provider) applySearchPath(ctx context.Context, name, username string, searchPath []string, reporter database.Reporter) error {
+	var settings []string
+	queryError := p.dbConnection.QueryRow(ctx, "SELECT COALESCE((SELECT s.setconfig FROM pg_db_role_setting s JOIN pg_database d ON d.oid = s.setdatabase JOIN pg_roles r ON r.oid = s.setrole WHERE d.datname = $1 AND r.rolname = $2), '{}')", name, username).Scan(&settings)
+	if queryError != nil {
+		return queryError
+	}
+	current, isSet := roleSetting(settings, "search_path")
+	switch {
+	case len(searchPath) == 0 && !isSet:
+		return nil
+	case len(searchPath) == 0:
+		reporter.Report("AlteringUser", "reset search_path of user", username)
+		_, alterRoleError := p.dbConnection.Exec(ctx, fmt.Sprintf("ALTER ROLE %s IN DATABASE %s RESET search_path", quoteIdentifier(username), quoteIdentifier(name)))
+		return alterRoleError
+	case isSet && slices.Equal(parseSearchPath(current), searchPath):
+		return nil
+	}
+
+	quotedSchemas := make([]string, 0, len(searchPath))
+	for _, schema := range searchPath {
+		quotedSchemas = append(quotedSchemas, quoteIdentifier(schema))
+	}
+	reporter.Report("AlteringUser", "set search_path "+strings.Join(searchPath, ", ")+" of user", username)
+	_, alterRoleError := p.dbConnection.Exec(ctx, fmt.Sprintf("ALTER ROLE %s IN DATABASE %s SET search_path = %s", quoteIdentifier(username), quoteIdentifier(name), strings.Join(quotedSchemas, ", ")))
+	return alterRoleError
+}
+
+// parseSearchPath splits the search path setting into the schema names. The server stores the names separated by
+// commas, quoting the ones which are no lowercase identifiers.
+func parseSearchPath(value string) []string {
+	var schemas []string
+	var schema strings.Builder
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		switch character := value[i]; {
+		case character == '"' && quoted && i+1 < len(value) && value[i+1] == '"':
+			schema.WriteByte('"')
+			i++
+		case character == '"':
+			quoted = !quoted
+		case character == ',' && !quoted:
+			schemas = append(schemas, schema.String())
+			schema.Reset()
+		case character == ' ' && !quoted:
+			continue
+		default:
+			schema.WriteByte(character)
+		}
+	}
+	if value != "" {
+		schemas = append(schemas, schema.String())
+	}
+	return schemas
+}
@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchPath(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{name: "empty", input: "", expected: nil},
+		{name: "single schema", input: "app", expected: []string{"app"}},
+		{name: "multiple schemas", input: "app, reporting", expected: []string{"app", "reporting"}},
+		{name: "quoted schemas", input: `"App", "with, comma", "with ""quote"""`, expected: []string{"App", "with, comma", `with "quote"`}},
+		{name: "user placeholder", input: `"$user", public`, expected: []string{"$user", "public"}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, parseSearchPath(testCase.input))
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+)
+
+// profilePrivileges lists the privileges of the profiles without ownership, on tables and sequences.
+var profilePrivileges = map[database.UserProfile]struct{ tables, sequences string }{
+	database.UserProfileReadWrite: {tables: "SELECT, INSERT, UPDATE, DELETE", sequences: "USAGE, SELECT"},
+	database.UserProfileReadOnly:  {tables: "SELECT", sequences: "SELECT"},
+}
+
+func (p *Provider) ApplyUser(ctx context.Context, options database.UserOptions) error {
+	if options.Profile != database.UserProfileOwner && profilePrivileges[options.Profile].tables == "" {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "postgres", Option: "profile " + string(options.Profile)})
+	}
+	if len(options.AllowedHosts) > 0 {
+		return helper.Permanent(database.ErrUnsupportedOption{Provider: "postgres", Option: "allowedHosts"})
+	}
+	if verifyError := verifyLimits(options.Limits); verifyError != nil {
+		return verifyError
+	}
+
+	if applyUserError := p.applyUser(ctx, options.Username, options.Password, options.Reporter); applyUserError != nil {
+		return classifyError(applyUserError)
+	}
+	if applyLimitsError := p.applyLimits(ctx, options.Username, options.Limits, options.Reporter); applyLimitsError != nil {
+		return classifyError(applyLimitsError)
+	}
+
+	if options.PreviousProfile != "" && options.PreviousProfile != options.Profile {
+		options.Reporter.Report("RevokingPrivileges", "revoking "+string(options.PreviousProfile)+" privileges of user", options.Username)
+		if revokeError := p.revokePrivileges(ctx, options); revokeError != nil {
+			return classifyError(revokeError)
+		}
+	}
+
+	// privileges are granted again on every reconciliation, which covers the objects created in the meantime
+	if options.PreviousProfile != options.Profile {
+		options.Reporter.Report("GrantingPrivileges", "granting "+string(options.Profile)+" privileges to user", options.Username)
+	} else {
+		options.Reporter.Enforce("granting "+string(options.Profile)+" privileges to user", options.Username)
+	}
+	if options.Profile == database.UserProfileOwner {
+		return classifyError(p.grantOwnerRole(ctx, options.Owner, options.Username))
+	}
+	return classifyError(p.grantPrivileges(ctx, options))
+}
+
+// grantPrivileges grants the privileges of the profile on all existing objects. Default privileges cover the objects
+// created by the owner later on, which includes the objects created by all users acting on behalf of the owner.
+func (p *Provider) grantPrivileges(ctx context.Context, options database.UserOptions) error {
+	privileges := profilePrivileges[options.Profile]
+	username := quoteIdentifier(options.Username)
+
+	if _, grantConnectError := p.dbConnection.Exec(ctx, fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", quoteIdentifier(options.Name), username)); grantConnectError != nil {
+		return grantConnectError
+	}
+
+	return p.inDatabase(ctx, options.Name, func(connection *pgx.Conn) error {
+		schemas, listSchemasError := listSchemas(ctx, connection)
+		if listSchemasError != nil {
+			return listSchemasError
+		}
+
+		var statements []string
+		for _, schema := range schemas {
+			statements = append(statements,
+				fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", quoteIdentifier(schema), username),
+				fmt.Sprintf("GRANT %s ON ALL TABLES IN SCHEMA %s TO %s", privileges.tables, quoteIdentifier(schema), username),
+				fmt.Sprintf("GRANT %s ON ALL SEQUENCES IN SCHEMA %s TO %s", privileges.sequences, quoteIdentifier(schema), username),
+			)
+		}
+		owner := quoteIdentifier(options.Owner)
+		statements = append(statements,
+			fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT USAGE ON SCHEMAS TO %s", owner, username),
+			fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT %s ON TABLES TO %s", owner, privileges.tables, username),
+			fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s GRANT %s ON SEQUENCES TO %s", owner, privileges.sequences, username),
+		)
+
+		for _, statement := range statements {
+			if _, grantError := connection.Exec(ctx, statement); grantError != nil {
+				return grantError
+			}
+		}
+		return nil
+	})
+}
+
+// revokePrivileges takes away all privileges of the previous profile. Objects the user created on its own are handed
+// over to the owner.
+func (p *Provider) revokePrivileges(ctx context.Context, options database.UserOptions) error {
+	if options.PreviousProfile == database.UserProfileOwner {
+		if _, revokeRoleError := p.dbConnection.Exec(ctx, fmt.Sprintf("REVOKE %s FROM %s", quoteIdentifier(options.Owner), quoteIdentifier(options.Username))); revokeRoleError != nil {
+			return revokeRoleError
+		}
+		if _, resetRoleError := p.dbConnection.Exec(ctx, fmt.Sprintf("ALTER ROLE %s RESET role", quoteIdentifier(options.Username))); resetRoleError != nil {
+			return resetRoleError
+		}
+	}
+	return p.dropOwned(ctx, options)
+}
+
+func (p *Provider) DestroyUser(ctx context.Context, options database.UserOptions) error {
+	options.Reporter.Report("DestroyingUser", "destroying user", options.Username)
+	if dropOwnedError := p.dropOwned(ctx, options); dropOwnedError != nil && !helper.IsNotExistsError(dropOwnedError) {
+		return classifyError(dropOwnedError)
+	}
+	_, dropUserError := p.dbConnection.Exec(ctx, fmt.Sprintf("DROP USER %s", quoteIdentifier(options.Username)))
+	if dropUserError != nil && !helper.IsNotExistsError(dropUserError) {
+		return classifyError(dropUserError)
+	}
+	return nil
+}
+
+// dropOwned hands the objects of the user over to the owner and revokes all its privileges within the database.
+func (p *Provider) dropOwned(ctx context.Context, options database.UserOptions) error {
+	return p.inDatabase(ctx, options.Name, func(connection *pgx.Conn) error {
+		if _, reassignError := connection.Exec(ctx, fmt.Sprintf("REASSIGN OWNED BY %s TO %s", quoteIdentifier(options.Username), quoteIdentifier(options.Owner))); reassignError != nil {
+			return reassignError
+		}
+		_, dropOwnedError := connection.Exec(ctx, fmt.Sprintf("DROP OWNED BY %s", quoteIdentifier(options.Username)))
+		return dropOwnedError
+	})
+}
+
+// inDatabase runs the function with a dedicated connection to the given database, as privileges are scoped to a database.
+func (p *Provider) inDatabase(ctx context.Context, name string, run func(connection *pgx.Conn) error) error {
+	connection, connectError := p.connectTo(ctx, name)
+	if connectError != nil {
+		return connectError
+	}
+	defer connection.Close(ctx)
+	return run(connection)
+}
+
+// listSchemas returns all schemas of the connected database, except the ones of the system.
+func listSchemas(ctx context.Context, connection *pgx.Conn) ([]string, error) {
+	rows, queryError := connection.Query(ctx, "SELECT nspname FROM pg_namespace WHERE nspname <> 'information_schema' AND nspname NOT LIKE 'pg\\_%'")
+	if queryError != nil {
+		return nil, queryError
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
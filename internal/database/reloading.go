@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"external-db-operator/internal/password"
+)
+
+// ReloadingProvider delegates to a provider of the given name, which is replaced whenever it is initialized with
+// another dsn. This allows rotating the credentials of the operator without a restart. The provider is swapped
+// atomically, so calls never wait for a reload. Calls pending on the previous provider complete on it, it is closed
+// once the last of them returned.
+type ReloadingProvider struct {
+	name string
+	pool PoolSettings
+
+	// initializeMutex serializes connecting new providers, calls only load the current one.
+	initializeMutex sync.Mutex
+	current         atomic.Pointer[providerLease]
+}
+
+var _ Provider = &ReloadingProvider{}
+
+// providerLease counts the calls pending on a provider, so a retired provider is closed after the last of them.
+type providerLease struct {
+	provider Provider
+	dsn      string
+
+	mutex   sync.Mutex
+	pending int
+	retired bool
+}
+
+// acquire registers a call on the provider, unless the provider has been retired.
+func (l *providerLease) acquire() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.retired {
+		return false
+	}
+	l.pending++
+	return true
+}
+
+// release unregisters a call, closing the provider if it has been retired meanwhile and this was the last call.
+func (l *providerLease) release() {
+	l.mutex.Lock()
+	l.pending--
+	closing := l.retired && l.pending == 0
+	l.mutex.Unlock()
+	if closing {
+		l.close()
+	}
+}
+
+// retire stops new calls on the provider, closing it right away if no call is pending.
+func (l *providerLease) retire() error {
+	l.mutex.Lock()
+	closing := !l.retired && l.pending == 0
+	l.retired = true
+	l.mutex.Unlock()
+	if closing {
+		return l.provider.Close()
+	}
+	return nil
+}
+
+func (l *providerLease) isRetired() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.retired
+}
+
+func (l *providerLease) close() {
+	if closeError := l.provider.Close(); closeError != nil {
+		slog.Error("failed to close database provider", slog.String("error", closeError.Error()))
+	}
+}
+
+func NewReloadingProvider(name string, pool PoolSettings) (*ReloadingProvider, error) {
+	if _, found := registeredProviders[name]; !found {
+		return nil, ErrUnknownProvider{Name: name}
+	}
+	if validateError := pool.Validate(); validateError != nil {
+		return nil, validateError
+	}
+	return &ReloadingProvider{name: name, pool: pool}, nil
+}
+
+// Initialize connects a new provider with the dsn and retires the previous one, which is closed once its pending calls
+// returned. If the new provider fails to connect, the previous one is kept.
+func (r *ReloadingProvider) Initialize(ctx context.Context, dsn string) error {
+	if r.unchanged(dsn) {
+		return nil
+	}
+	r.initializeMutex.Lock()
+	defer r.initializeMutex.Unlock()
+	// another call may have connected with the dsn while this one was waiting
+	if r.unchanged(dsn) {
+		return nil
+	}
+
+	provider, provideError := Provide(r.name, r.pool)
+	if provideError != nil {
+		return provideError
+	}
+	if initializationError := provider.Initialize(ctx, dsn); initializationError != nil {
+		return initializationError
+	}
+
+	previous := r.current.Swap(&providerLease{provider: provider, dsn: dsn})
+	if previous == nil || previous.isRetired() {
+		return nil
+	}
+	slog.Info("reloaded database provider", slog.String("provider", r.name))
+	return previous.retire()
+}
+
+// unchanged reports whether the current provider is connected with the dsn already.
+func (r *ReloadingProvider) unchanged(dsn string) bool {
+	current := r.current.Load()
+	return current != nil && current.dsn == dsn && !current.isRetired()
+}
+
+// provider returns the current provider and a function releasing it, which must be called once the call returned.
+// After Close, the closed provider is returned, so calls fail instead of panicking.
+func (r *ReloadingProvider) provider() (Provider, func()) {
+	for {
+		current := r.current.Load()
+		if current == nil {
+			return nil, func() {}
+		}
+		if current.acquire() {
+			return current.provider, current.release
+		}
+		if r.current.Load() == current {
+			return current.provider, func() {}
+		}
+		// the provider has been replaced meanwhile, the call goes to the new one
+	}
+}
+
+func (r *ReloadingProvider) Apply(ctx context.Context, options CreateOptions) error {
+	provider, release := r.provider()
+	defer release()
+	return provider.Apply(ctx, options)
+}
+
+func (r *ReloadingProvider) Destroy(ctx context.Context, options DestroyOptions) error {
+	provider, release := r.provider()
+	defer release()
+	return provider.Destroy(ctx, options)
+}
+
+func (r *ReloadingProvider) ApplyUser(ctx context.Context, options UserOptions) error {
+	provider, release := r.provider()
+	defer release()
+	return provider.ApplyUser(ctx, options)
+}
+
+func (r *ReloadingProvider) DestroyUser(ctx context.Context, options UserOptions) error {
+	provider, release := r.provider()
+	defer release()
+	return provider.DestroyUser(ctx, options)
+}
+
+func (r *ReloadingProvider) ApplySchemas(ctx context.Context, options SchemaOptions) error {
+	provider, release := r.provider()
+	defer release()
+	return provider.ApplySchemas(ctx, options)
+}
+
+func (r *ReloadingProvider) DatabaseExists(ctx context.Context, name string) (bool, error) {
+	provider, release := r.provider()
+	defer release()
+	return provider.DatabaseExists(ctx, name)
+}
+
+func (r *ReloadingProvider) UserExists(ctx context.Context, name string) (bool, error) {
+	provider, release := r.provider()
+	defer release()
+	return provider.UserExists(ctx, name)
+}
+
+func (r *ReloadingProvider) Dump(ctx context.Context, name string, w io.Writer) error {
+	provider, release := r.provider()
+	defer release()
+	return provider.Dump(ctx, name, w)
+}
+
+func (r *ReloadingProvider) GetConnectionInfo(ctx context.Context) (ConnectionInfo, error) {
+	provider, release := r.provider()
+	defer release()
+	return provider.GetConnectionInfo(ctx)
+}
+
+func (r *ReloadingProvider) ConnectionStrings(credentials Credentials) ConnectionStrings {
+	provider, release := r.provider()
+	defer release()
+	return provider.ConnectionStrings(credentials)
+}
+
+func (r *ReloadingProvider) FormatDSN(credentials Credentials, parameters map[string]string) string {
+	provider, release := r.provider()
+	defer release()
+	return provider.FormatDSN(credentials, parameters)
+}
+
+func (r *ReloadingProvider) NamingRules() NamingRules {
+	provider, release := r.provider()
+	defer release()
+	return provider.NamingRules()
+}
+
+func (r *ReloadingProvider) PasswordRequirements() password.Requirements {
+	provider, release := r.provider()
+	defer release()
+	return provider.PasswordRequirements()
+}
+
+func (r *ReloadingProvider) HealthCheck(ctx context.Context) error {
+	provider, release := r.provider()
+	defer release()
+	return provider.HealthCheck(ctx)
+}
+
+// Close retires the current provider, which is closed once all pending calls returned. The next Initialize connects
+// again.
+func (r *ReloadingProvider) Close() error {
+	r.initializeMutex.Lock()
+	defer r.initializeMutex.Unlock()
+
+	current := r.current.Load()
+	if current == nil {
+		return nil
+	}
+	return current.retire()
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider records the dsn it has been initialized with and how often it has been closed. Its HealthCheck blocks
+// until block is closed, if set.
+type fakeProvider struct {
+	Provider
+	dsn     string
+	closed  atomic.Int32
+	block   chan struct{}
+	entered chan struct{}
+}
+
+func (f *fakeProvider) HealthCheck(_ context.Context) error {
+	if f.block != nil {
+		close(f.entered)
+		<-f.block
+	}
+	return nil
+}
+
+func (f *fakeProvider) Initialize(_ context.Context, dsn string) error {
+	f.dsn = dsn
+	return nil
+}
+
+func (f *fakeProvider) Close() error {
+	f.closed.Add(1)
+	return nil
+}
+
+func TestReloadingProvider(t *testing.T) {
+	var provided []*fakeProvider
+	RegisterProvider("fake", func(PoolSettings) Provider {
+		provider := &fakeProvider{}
+		provided = append(provided, provider)
+		return provider
+	})
+	t.Cleanup(func() { delete(registeredProviders, "fake") })
+
+	reloading, newProviderError := NewReloadingProvider("fake", PoolSettings{})
+	require.NoError(t, newProviderError)
+	ctx := context.Background()
+
+	require.NoError(t, reloading.Initialize(ctx, "first"))
+	require.NoError(t, reloading.Initialize(ctx, "first"))
+	assert.Len(t, provided, 1, "unchanged dsn keeps the provider")
+
+	require.NoError(t, reloading.Initialize(ctx, "second"))
+	require.Len(t, provided, 2)
+	assert.EqualValues(t, 1, provided[0].closed.Load(), "replaced provider is closed")
+	assert.Equal(t, "second", provided[1].dsn)
+
+	require.NoError(t, reloading.Close())
+	require.NoError(t, reloading.Close())
+	assert.EqualValues(t, 1, provided[1].closed.Load(), "closed provider is closed once")
+
+	require.NoError(t, reloading.Initialize(ctx, "second"))
+	assert.Len(t, provided, 3, "closed provider reconnects with the same dsn")
+	assert.EqualValues(t, 1, provided[1].closed.Load())
+}
+
+func TestReloadingProviderPendingCall(t *testing.T) {
+	var provided []*fakeProvider
+	RegisterProvider("fake", func(PoolSettings) Provider {
+		provider := &fakeProvider{}
+		provided = append(provided, provider)
+		return provider
+	})
+	t.Cleanup(func() { delete(registeredProviders, "fake") })
+
+	reloading, newProviderError := NewReloadingProvider("fake", PoolSettings{})
+	require.NoError(t, newProviderError)
+	ctx := context.Background()
+	require.NoError(t, reloading.Initialize(ctx, "first"))
+
+	provided[0].block = make(chan struct{})
+	provided[0].entered = make(chan struct{})
+	pending := make(chan error)
+	go func() { pending <- reloading.HealthCheck(ctx) }()
+	<-provided[0].entered
+
+	reloaded := make(chan error)
+	go func() { reloaded <- reloading.Initialize(ctx, "second") }()
+	select {
+	case reloadError := <-reloaded:
+		require.NoError(t, reloadError)
+	case <-time.After(time.Second):
+		t.Fatal("reload waits for the pending call")
+	}
+	assert.Zero(t, provided[0].closed.Load(), "provider with a pending call is kept open")
+
+	called := make(chan error)
+	go func() { called <- reloading.HealthCheck(ctx) }()
+	select {
+	case callError := <-called:
+		require.NoError(t, callError)
+	case <-time.After(time.Second):
+		t.Fatal("call waits for the pending call on the previous provider")
+	}
+
+	close(provided[0].block)
+	require.NoError(t, <-pending)
+	assert.EqualValues(t, 1, provided[0].closed.Load(), "previous provider is closed after its last call")
+	assert.Zero(t, provided[1].closed.Load())
+}
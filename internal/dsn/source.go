@@ -0,0 +1,85 @@
+// Package dsn loads the dsn of the database server from outside the operator settings and watches it for changes.
+package dsn
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Source provides the current dsn.
+type Source interface {
+	Load(ctx context.Context) (string, error)
+}
+
+// File reads the dsn from a file, e.g. a mounted secret. Surrounding whitespace is ignored.
+type File struct {
+	Path string
+}
+
+func (f File) Load(_ context.Context) (string, error) {
+	content, readError := os.ReadFile(f.Path)
+	if readError != nil {
+		return "", readError
+	}
+	return nonEmpty(strings.TrimSpace(string(content)), f.Path)
+}
+
+// Secret reads the dsn from a key of a kubernetes secret. Surrounding whitespace is ignored.
+type Secret struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Name      string
+	Key       string
+}
+
+func (s Secret) Load(ctx context.Context) (string, error) {
+	secret, getSecretError := s.Client.CoreV1().Secrets(s.Namespace).Get(ctx, s.Name, metav1.GetOptions{})
+	if getSecretError != nil {
+		return "", getSecretError
+	}
+	return nonEmpty(strings.TrimSpace(string(secret.Data[s.Key])), "key "+s.Key+" of secret "+s.Namespace+"/"+s.Name)
+}
+
+func nonEmpty(dsn, origin string) (string, error) {
+	if dsn == "" {
+		return "", fmt.Errorf("no dsn found in %s", origin)
+	}
+	return dsn, nil
+}
+
+// Watch loads the dsn from the source in the given interval and calls apply whenever it differs from the last applied
+// one, until the context is cancelled. Failed loads and applies are retried with the next interval.
+func Watch(ctx context.Context, source Source, current string, interval time.Duration, apply func(ctx context.Context, dsn string) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		dsn, loadError := source.Load(ctx)
+		if loadError != nil {
+			slog.Error("failed to load database dsn", slog.String("error", loadError.Error()))
+			continue
+		}
+		if dsn == current {
+			continue
+		}
+		slog.Info("database dsn changed, reconnecting")
+		if applyError := apply(ctx, dsn); applyError != nil {
+			slog.Error("failed to apply database dsn", slog.String("error", applyError.Error()))
+			continue
+		}
+		current = dsn
+	}
+}
@@ -1,6 +1,7 @@
 package helper
 
 import (
+	"errors"
 	"strings"
 )
 
@@ -11,3 +12,29 @@ func IsAlreadyExistsError(err error) bool {
 func IsNotExistsError(err error) bool {
 	return err != nil && strings.Contains(err.Error(), "does not exist")
 }
+
+// ErrPermanent marks an error which will not resolve itself by retrying the failed operation.
+type ErrPermanent struct {
+	Err error
+}
+
+func (e ErrPermanent) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrPermanent) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps the given error as ErrPermanent. A nil error is returned unchanged.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return ErrPermanent{Err: err}
+}
+
+func IsPermanentError(err error) bool {
+	var permanentError ErrPermanent
+	return errors.As(err, &permanentError)
+}
@@ -0,0 +1,47 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// FinalizerName blocks the removal of database resources until the operator has cleaned up the database, user and secret.
+const FinalizerName = "bonsai-oss.org/external-db-operator"
+
+func hasFinalizer(object *unstructured.Unstructured) bool {
+	return slices.Contains(object.GetFinalizers(), FinalizerName)
+}
+
+func (m *Manager) addFinalizer(ctx context.Context, object *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	slog.Info("adding finalizer", slog.String("name", object.GetName()), slog.String("namespace", object.GetNamespace()))
+	object.SetFinalizers(append(object.GetFinalizers(), FinalizerName))
+
+	updatedObject, updateError := m.clients.KubernetesDynamic.Resource(resourcesv1.DatabaseResource).Namespace(object.GetNamespace()).Update(ctx, object, metav1.UpdateOptions{})
+	if updateError != nil {
+		return nil, fmt.Errorf("failed to add finalizer: %w", classifyKubernetesError(updateError))
+	}
+
+	return updatedObject, nil
+}
+
+func (m *Manager) removeFinalizer(ctx context.Context, object *unstructured.Unstructured) error {
+	slog.Info("removing finalizer", slog.String("name", object.GetName()), slog.String("namespace", object.GetNamespace()))
+	object.SetFinalizers(slices.DeleteFunc(object.GetFinalizers(), func(finalizer string) bool {
+		return finalizer == FinalizerName
+	}))
+
+	_, updateError := m.clients.KubernetesDynamic.Resource(resourcesv1.DatabaseResource).Namespace(object.GetNamespace()).Update(ctx, object, metav1.UpdateOptions{})
+	if updateError != nil && !errors.IsNotFound(updateError) {
+		return fmt.Errorf("failed to remove finalizer: %w", classifyKubernetesError(updateError))
+	}
+
+	return nil
+}
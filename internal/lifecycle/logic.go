@@ -4,86 +4,499 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/google/uuid"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 
 	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	"external-db-operator/internal/password"
 	resourcesv1 "external-db-operator/internal/resources/v1"
+	"external-db-operator/internal/secret"
 )
 
-func (m *Manager) handleEvent(event watch.Event) error {
+// eventOutcome reports the changes made while handling an event, which are reflected in the status of the resource.
+type eventOutcome struct {
+	// LastPasswordRotation is the time the current password has been set, zero if unknown.
+	LastPasswordRotation time.Time
+	// Users are the provisioned additional users.
+	Users []resourcesv1.DatabaseUserStatus
+	// Extensions are the names of the managed extensions.
+	Extensions []string
+	// Logins, ActiveUsername, RetiredUsername and RetiredPasswordResetAt reflect the state of the dual user rotation.
+	Logins                 []string
+	ActiveUsername         string
+	RetiredUsername        string
+	RetiredPasswordResetAt time.Time
+}
+
+// handleEvent provisions or removes the database of the resource on the database server of the given provider.
+func (m *Manager) handleEvent(ctx context.Context, event watch.Event, names resourceNames, provider database.Provider) (eventOutcome, error) {
 	databaseResourceData, convertError := resourcesv1.FromUnstructured(event.Object)
 	if convertError != nil {
-		return fmt.Errorf("failed to convert unstructured object: %w", convertError)
+		return eventOutcome{}, helper.Permanent(fmt.Errorf("failed to convert unstructured object: %w", convertError))
 	}
 
-	// TODO: handle GetConnectionInfo error
-	connectionInfo, _ := m.clients.Database.GetConnectionInfo()
+	connectionInfo, getConnectionInfoError := provider.GetConnectionInfo(ctx)
+	if getConnectionInfoError != nil {
+		return eventOutcome{}, helper.Permanent(fmt.Errorf("failed to get connection info: %w", getConnectionInfoError))
+	}
 
+	secretAnnotations := maps.Clone(databaseResourceData.Annotations)
+	delete(secretAnnotations, resourcesv1.RotatePasswordAnnotation)
 	secretData := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        m.secretPrefix + "-" + databaseResourceData.Name,
-			Annotations: databaseResourceData.Annotations,
-			Labels:      databaseResourceData.Labels,
+			Name:            m.secretName(databaseResourceData),
+			Annotations:     secretAnnotations,
+			Labels:          databaseResourceData.Labels,
+			OwnerReferences: []metav1.OwnerReference{ownerReference(databaseResourceData)},
 		},
 		StringData: map[string]string{
-			"username": databaseResourceData.AssembleDatabaseName(),
-			"password": uuid.NewString(),
+			"username": names.User,
+			"password": "",
 			"host":     connectionInfo.Host,
 			"port":     fmt.Sprintf("%d", connectionInfo.Port),
-			"database": databaseResourceData.AssembleDatabaseName(),
+			"database": names.Database,
 		},
 	}
 
-	existingSecret, getExistingSecretError := m.clients.Kubernetes.CoreV1().Secrets(databaseResourceData.Namespace).Get(context.Background(), secretData.Name, metav1.GetOptions{})
+	existingSecret, getExistingSecretError := m.clients.Kubernetes.CoreV1().Secrets(databaseResourceData.Namespace).Get(ctx, secretData.Name, metav1.GetOptions{})
 	if getExistingSecretError != nil && !errors.IsNotFound(getExistingSecretError) {
-		panic(getExistingSecretError.Error())
+		return eventOutcome{}, fmt.Errorf("failed to get secret: %w", classifyKubernetesError(getExistingSecretError))
+	}
+	if getExistingSecretError == nil && event.Type != watch.Deleted {
+		if ownerError := verifySecretOwner(databaseResourceData, existingSecret); ownerError != nil {
+			return eventOutcome{}, ownerError
+		}
+	}
+
+	reporter := func(reason, message string) {
+		m.recorder.Event(event.Object, corev1.EventTypeNormal, reason, message)
 	}
 
+	now := time.Now()
+	outcome := eventOutcome{LastPasswordRotation: now}
+	var rotatePassword bool
 	if !errors.IsNotFound(getExistingSecretError) {
-		// existingSecret.StringData is not populated by the Get() method
-		secretData.StringData["password"] = string(existingSecret.Data["password"])
+		var rotationError error
+		if rotatePassword, rotationError = passwordRotationDue(databaseResourceData, existingSecret, now); rotationError != nil {
+			return eventOutcome{}, rotationError
+		}
+		rotatePassword = rotatePassword && event.Type != watch.Deleted
+		if !rotatePassword {
+			// existingSecret.StringData is not populated by the Get() method
+			secretData.StringData["password"] = string(existingSecret.Data["password"])
+			outcome.LastPasswordRotation = lastPasswordRotation(databaseResourceData, existingSecret)
+		}
+	}
+
+	var plan credentialPlan
+	var policy password.Policy
+	if event.Type != watch.Deleted {
+		var policyError error
+		if policy, policyError = m.passwordPolicy(databaseResourceData, provider); policyError != nil {
+			return eventOutcome{}, policyError
+		}
+		if secretData.StringData["password"] == "" {
+			newPassword, generateError := password.Generate(policy)
+			if generateError != nil {
+				return eventOutcome{}, generateError
+			}
+			secretData.StringData["password"] = newPassword
+		}
+
+		var planError error
+		plan, planError = m.planCredentials(databaseResourceData, provider, names, policy, secretData.StringData["password"], !errors.IsNotFound(getExistingSecretError), rotatePassword, now, &outcome)
+		if planError != nil {
+			return eventOutcome{}, planError
+		}
+		secretData.StringData["username"] = plan.Username
+		if rotatePassword {
+			reporter("RotatingPassword", "rotating password of user "+plan.Username)
+		}
+
+		renderedKeys, renderError := m.renderSecretTemplate(databaseResourceData, provider, database.Credentials{
+			Host:     connectionInfo.Host,
+			Port:     connectionInfo.Port,
+			Database: names.Database,
+			Username: plan.Username,
+			Password: secretData.StringData["password"],
+		})
+		if renderError != nil {
+			return eventOutcome{}, renderError
+		}
+		maps.Copy(secretData.StringData, renderedKeys)
 	}
 
-	var databaseActionError error
 	switch event.Type {
 	case watch.Modified:
 		fallthrough
 	case watch.Added:
-		databaseActionError = m.clients.Database.Apply(database.CreateOptions{
-			Name:     databaseResourceData.AssembleDatabaseName(),
-			Password: secretData.StringData["password"],
+		limits, limitsError := resourceLimits(databaseResourceData)
+		if limitsError != nil {
+			return eventOutcome{}, limitsError
+		}
+		extensions, droppedExtensions, extensionsError := resourceExtensions(databaseResourceData)
+		if extensionsError != nil {
+			return eventOutcome{}, extensionsError
+		}
+		applyContext, cancelApply := m.databaseContext(ctx)
+		databaseActionError := provider.Apply(applyContext, database.CreateOptions{
+			Name:              names.Database,
+			Username:          names.User,
+			Password:          plan.OwnerPassword,
+			Logins:            plan.Logins,
+			Charset:           databaseResourceData.Spec.Charset,
+			Collation:         databaseResourceData.Spec.Collation,
+			Encoding:          databaseResourceData.Spec.Encoding,
+			Locale:            databaseResourceData.Spec.Locale,
+			Template:          databaseResourceData.Spec.Template,
+			Privileges:        databaseResourceData.Spec.Privileges,
+			AllowedHosts:      m.allowedHosts(databaseResourceData),
+			Limits:            limits,
+			Extensions:        extensions,
+			DroppedExtensions: droppedExtensions,
+			Reporter:          reporter,
 		})
+		cancelApply()
+		if databaseActionError != nil {
+			return eventOutcome{}, fmt.Errorf("failed to apply database: %w", databaseActionError)
+		}
+		for _, extension := range extensions {
+			outcome.Extensions = append(outcome.Extensions, extension.Name)
+		}
 
-		var secretError error
 		if errors.IsNotFound(getExistingSecretError) {
-			slog.Info("creating secret", slog.String("name", secretData.Name), slog.String("namespace", databaseResourceData.Namespace))
-			_, secretError = m.clients.Kubernetes.CoreV1().Secrets(databaseResourceData.Namespace).Create(context.Background(), secretData, metav1.CreateOptions{})
-		} else {
-			slog.Info("updating secret", slog.String("name", secretData.Name), slog.String("namespace", databaseResourceData.Namespace))
-			_, secretError = m.clients.Kubernetes.CoreV1().Secrets(databaseResourceData.Namespace).Update(context.Background(), secretData, metav1.UpdateOptions{})
+			existingSecret = nil
+		}
+		if secretError := m.writeSecret(ctx, databaseResourceData.Namespace, secretData, existingSecret, reporter); secretError != nil {
+			return eventOutcome{}, secretError
+		}
+
+		var usersError error
+		if outcome.Users, usersError = m.reconcileUsers(ctx, databaseResourceData, provider, names, connectionInfo, policy, limits, rotatePassword, secretData.ObjectMeta, reporter); usersError != nil {
+			return eventOutcome{}, usersError
 		}
-		if secretError != nil {
-			panic(secretError.Error())
+
+		schemaOptions, schemasError := resourceSchemas(databaseResourceData, names, outcome.Logins, outcome.Users)
+		if schemasError != nil {
+			return eventOutcome{}, schemasError
+		}
+		schemaOptions.Reporter = reporter
+		schemasContext, cancelSchemas := m.databaseContext(ctx)
+		applySchemasError := provider.ApplySchemas(schemasContext, schemaOptions)
+		cancelSchemas()
+		if applySchemasError != nil {
+			return eventOutcome{}, fmt.Errorf("failed to apply schemas: %w", applySchemasError)
 		}
 	case watch.Deleted:
-		databaseActionError = m.clients.Database.Destroy(database.DestroyOptions{
-			Name: databaseResourceData.AssembleDatabaseName(),
-		})
+		deletionPolicy, deletionPolicyError := m.deletionPolicy(databaseResourceData)
+		if deletionPolicyError != nil {
+			// the policy is validated by the api server, resources stored before are kept rather than stuck in deletion
+			m.recorder.Event(event.Object, corev1.EventTypeWarning, "DeletionPolicyInvalid", deletionPolicyError.Error()+", retaining the database")
+			deletionPolicy = database.DeletionPolicyRetain
+		}
+		// resources which have never been provisioned do not own anything on the database server
+		if !names.IsEmpty() {
+			if deletionPolicy == database.DeletionPolicySnapshot {
+				deletionPolicy = database.DeletionPolicyDelete
+				if snapshotError := m.takeSnapshot(ctx, databaseResourceData, names, provider, reporter); snapshotError != nil {
+					if !m.finalAttempt(event.Object, snapshotError) {
+						return eventOutcome{}, snapshotError
+					}
+					// a database which cannot be snapshotted is kept, instead of dropping it or blocking the deletion for good
+					m.recorder.Event(event.Object, corev1.EventTypeWarning, "SnapshotFailed", snapshotError.Error()+", retaining the database")
+					deletionPolicy = database.DeletionPolicyRetain
+				}
+			}
+
+			destroyContext, cancelDestroy := m.databaseContext(ctx)
+			databaseActionError := provider.Destroy(destroyContext, database.DestroyOptions{
+				Name:        names.Database,
+				Username:    names.User,
+				Logins:      slices.Concat(databaseResourceData.Status.Logins, additionalUsernames(databaseResourceData.Status.Users)),
+				Policy:      deletionPolicy,
+				RevokeLogin: databaseResourceData.Spec.RevokeLogin,
+				Reporter:    reporter,
+			})
+			cancelDestroy()
+			if databaseActionError != nil {
+				return eventOutcome{}, fmt.Errorf("failed to destroy database: %w", databaseActionError)
+			}
+		}
+
+		// secrets without owner reference have been written by previous operator versions, but if the names of the
+		// resource collided, they may just as well belong to another resource
+		ownsUnmarked := !names.IsEmpty()
+		for _, user := range databaseResourceData.Status.Users {
+			if secretDeleteError := m.deleteSecret(ctx, databaseResourceData, user.SecretName, ownsUnmarked, reporter); secretDeleteError != nil {
+				return eventOutcome{}, secretDeleteError
+			}
+		}
+		if secretDeleteError := m.deleteSecret(ctx, databaseResourceData, secretData.Name, ownsUnmarked, reporter); secretDeleteError != nil {
+			return eventOutcome{}, secretDeleteError
+		}
+		return eventOutcome{}, nil
+	}
+
+	return outcome, nil
+}
+
+// writeSecret creates the secret or replaces the existing one, unless it is up to date already.
+func (m *Manager) writeSecret(ctx context.Context, namespace string, secretData, existingSecret *corev1.Secret, reporter database.Reporter) error {
+	var secretError error
+	switch {
+	case existingSecret == nil:
+		slog.Info("creating secret", slog.String("name", secretData.Name), slog.String("namespace", namespace))
+		reporter("CreatingSecret", "creating secret "+secretData.Name)
+		_, secretError = m.clients.Kubernetes.CoreV1().Secrets(namespace).Create(ctx, secretData, metav1.CreateOptions{})
+	case secretUpToDate(existingSecret, secretData):
+		return nil
+	default:
+		slog.Info("updating secret", slog.String("name", secretData.Name), slog.String("namespace", namespace))
+		reporter("UpdatingSecret", "updating secret "+secretData.Name)
+		_, secretError = m.clients.Kubernetes.CoreV1().Secrets(namespace).Update(ctx, secretData, metav1.UpdateOptions{})
+	}
+	if secretError != nil {
+		return fmt.Errorf("failed to write secret: %w", classifyKubernetesError(secretError))
+	}
+	return nil
+}
 
-		slog.Info("deleting secret", slog.String("name", secretData.Name), slog.String("namespace", databaseResourceData.Namespace))
-		secretDeleteError := m.clients.Kubernetes.CoreV1().Secrets(databaseResourceData.Namespace).Delete(context.Background(), secretData.Name, metav1.DeleteOptions{})
-		if secretDeleteError != nil && !errors.IsNotFound(secretDeleteError) {
-			panic(secretDeleteError.Error())
+// secretUpToDate reports whether the existing secret holds the data and metadata of the rendered one.
+func secretUpToDate(existingSecret, secretData *corev1.Secret) bool {
+	if len(existingSecret.Data) != len(secretData.StringData) {
+		return false
+	}
+	for key, value := range secretData.StringData {
+		if existingValue, found := existingSecret.Data[key]; !found || string(existingValue) != value {
+			return false
 		}
 	}
-	if databaseActionError != nil {
-		panic(databaseActionError.Error())
+	return equality.Semantic.DeepEqual(existingSecret.Labels, secretData.Labels) &&
+		equality.Semantic.DeepEqual(existingSecret.Annotations, secretData.Annotations) &&
+		equality.Semantic.DeepEqual(existingSecret.OwnerReferences, secretData.OwnerReferences)
+}
+
+// deleteSecret deletes the secret, if it is owned by the resource. Secrets without owner reference are only deleted if
+// ownsUnmarked is set.
+func (m *Manager) deleteSecret(ctx context.Context, databaseResourceData *resourcesv1.Database, name string, ownsUnmarked bool, reporter database.Reporter) error {
+	namespace := databaseResourceData.Namespace
+	existingSecret, getSecretError := m.clients.Kubernetes.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(getSecretError) {
+		return nil
+	}
+	if getSecretError != nil {
+		return fmt.Errorf("failed to get secret: %w", classifyKubernetesError(getSecretError))
+	}
+	if !ownsSecret(databaseResourceData, existingSecret, ownsUnmarked) {
+		slog.Info("keeping secret of another owner", slog.String("name", name), slog.String("namespace", namespace))
+		return nil
 	}
 
+	slog.Info("deleting secret", slog.String("name", name), slog.String("namespace", namespace))
+	reporter("DeletingSecret", "deleting secret "+name)
+	secretDeleteError := m.clients.Kubernetes.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{Preconditions: metav1.NewUIDPreconditions(string(existingSecret.UID))})
+	if secretDeleteError != nil && !errors.IsNotFound(secretDeleteError) {
+		return fmt.Errorf("failed to delete secret: %w", classifyKubernetesError(secretDeleteError))
+	}
 	return nil
 }
+
+// ownerReference refers to the resource from the secrets written for it.
+func ownerReference(databaseResourceData *resourcesv1.Database) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: resourcesv1.DatabaseResource.GroupVersion().String(),
+		Kind:       resourcesv1.DatabaseKind,
+		Name:       databaseResourceData.Name,
+		UID:        databaseResourceData.UID,
+	}
+}
+
+// ownsSecret reports whether the secret is owned by the resource. Secrets without owner reference are considered owned
+// if ownsUnmarked is set.
+func ownsSecret(databaseResourceData *resourcesv1.Database, secretData *corev1.Secret, ownsUnmarked bool) bool {
+	if len(secretData.OwnerReferences) == 0 {
+		return ownsUnmarked
+	}
+	return slices.ContainsFunc(secretData.OwnerReferences, func(reference metav1.OwnerReference) bool { return reference.UID == databaseResourceData.UID })
+}
+
+// verifySecretOwner ensures an existing secret is not owned by anything else, before the resource overwrites it.
+func verifySecretOwner(databaseResourceData *resourcesv1.Database, secretData *corev1.Secret) error {
+	if ownsSecret(databaseResourceData, secretData, true) {
+		return nil
+	}
+	reference := secretData.OwnerReferences[0]
+	return helper.Permanent(ErrNameCollision{Name: secretData.Name, Owner: strings.ToLower(reference.Kind) + " " + secretData.Namespace + "/" + reference.Name})
+}
+
+// classifyKubernetesError marks api server errors as permanent, if the request itself has been rejected.
+func classifyKubernetesError(err error) error {
+	if errors.IsInvalid(err) || errors.IsBadRequest(err) || errors.IsRequestEntityTooLargeError(err) {
+		return helper.Permanent(err)
+	}
+	return err
+}
+
+// renderSecretTemplate renders the additional secret keys from the operator default and the resource secret template.
+func (m *Manager) renderSecretTemplate(databaseResourceData *resourcesv1.Database, provider database.Provider, credentials database.Credentials) (map[string]string, error) {
+	resourceTemplate, parseError := secret.Parse(databaseResourceData.Spec.SecretTemplate)
+	if parseError != nil {
+		return nil, helper.Permanent(parseError)
+	}
+
+	renderedKeys, renderError := m.settings.SecretTemplate.Override(resourceTemplate).Render(credentials, provider.ConnectionStrings(credentials))
+	if renderError != nil {
+		return nil, helper.Permanent(renderError)
+	}
+	return renderedKeys, nil
+}
+
+// databaseContext bounds a single operation on the database server by the configured timeout.
+func (m *Manager) databaseContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.settings.DatabaseTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, m.settings.DatabaseTimeout)
+}
+
+// passwordPolicy returns the password policy of the resource, overriding the operator default with the fields of the
+// spec. The policy must satisfy the password requirements of the database server.
+func (m *Manager) passwordPolicy(databaseResourceData *resourcesv1.Database, provider database.Provider) (password.Policy, error) {
+	policy := m.settings.PasswordPolicy
+	if specPolicy := databaseResourceData.Spec.PasswordPolicy; specPolicy != nil {
+		for _, override := range []struct {
+			value  *int
+			target *int
+		}{
+			{value: specPolicy.Length, target: &policy.Length},
+			{value: specPolicy.Lowercase, target: &policy.Lowercase},
+			{value: specPolicy.Uppercase, target: &policy.Uppercase},
+			{value: specPolicy.Digits, target: &policy.Digits},
+			{value: specPolicy.Special, target: &policy.Special},
+		} {
+			if override.value != nil {
+				*override.target = *override.value
+			}
+		}
+	}
+
+	if validationError := policy.Validate(); validationError != nil {
+		return password.Policy{}, helper.Permanent(validationError)
+	}
+	if requirementsError := policy.Satisfies(provider.PasswordRequirements()); requirementsError != nil {
+		return password.Policy{}, helper.Permanent(requirementsError)
+	}
+	return policy, nil
+}
+
+// allowedHosts returns the hosts the users of the resource may connect from, falling back to the operator default
+// for resources on the default database server.
+func (m *Manager) allowedHosts(databaseResourceData *resourcesv1.Database) []string {
+	if databaseResourceData.Spec.MySQL != nil && len(databaseResourceData.Spec.MySQL.AllowedHosts) > 0 {
+		return databaseResourceData.Spec.MySQL.AllowedHosts
+	}
+	if serverName(databaseResourceData) != "" {
+		return nil
+	}
+	return m.settings.DefaultAllowedHosts
+}
+
+// resourceLimits converts the limits of the spec, parsing the timeouts.
+func resourceLimits(databaseResourceData *resourcesv1.Database) (database.Limits, error) {
+	specLimits := databaseResourceData.Spec.Limits
+	if specLimits == nil {
+		return database.Limits{}, nil
+	}
+
+	limits := database.Limits{
+		ConnectionLimit:       specLimits.ConnectionLimit,
+		MaxQueriesPerHour:     specLimits.MaxQueriesPerHour,
+		MaxUpdatesPerHour:     specLimits.MaxUpdatesPerHour,
+		MaxConnectionsPerHour: specLimits.MaxConnectionsPerHour,
+	}
+	for _, timeout := range []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{name: "statementTimeout", value: specLimits.StatementTimeout, target: &limits.StatementTimeout},
+		{name: "idleInTransactionSessionTimeout", value: specLimits.IdleInTransactionSessionTimeout, target: &limits.IdleInTransactionSessionTimeout},
+	} {
+		if timeout.value == "" {
+			continue
+		}
+		duration, parseError := time.ParseDuration(timeout.value)
+		if parseError != nil || duration < 0 {
+			return database.Limits{}, helper.Permanent(fmt.Errorf("invalid %s: %s", timeout.name, timeout.value))
+		}
+		*timeout.target = duration
+	}
+
+	for name, value := range map[string]int{"connectionLimit": limits.ConnectionLimit, "maxQueriesPerHour": limits.MaxQueriesPerHour, "maxUpdatesPerHour": limits.MaxUpdatesPerHour, "maxConnectionsPerHour": limits.MaxConnectionsPerHour} {
+		if value < 0 {
+			return database.Limits{}, helper.Permanent(fmt.Errorf("invalid %s: %d", name, value))
+		}
+	}
+	return limits, nil
+}
+
+// resourceExtensions returns the extensions of the spec, as well as the previously managed extensions to drop.
+// Extensions removed from the spec are only dropped if requested, otherwise they are no longer managed.
+func resourceExtensions(databaseResourceData *resourcesv1.Database) ([]database.Extension, []string, error) {
+	specPostgres := databaseResourceData.Spec.Postgres
+	if specPostgres == nil {
+		specPostgres = &resourcesv1.PostgresSpec{}
+	}
+
+	var extensions []database.Extension
+	for _, extension := range specPostgres.Extensions {
+		if extension.Name == "" {
+			return nil, nil, helper.Permanent(fmt.Errorf("extension name must not be empty"))
+		}
+		if slices.ContainsFunc(extensions, func(other database.Extension) bool { return other.Name == extension.Name }) {
+			return nil, nil, helper.Permanent(fmt.Errorf("extension %s is listed more than once", extension.Name))
+		}
+		extensions = append(extensions, database.Extension{Name: extension.Name, Version: extension.Version})
+	}
+
+	var droppedExtensions []string
+	if specPostgres.DropRemovedExtensions {
+		for _, name := range databaseResourceData.Status.Extensions {
+			if !slices.ContainsFunc(extensions, func(extension database.Extension) bool { return extension.Name == name }) {
+				droppedExtensions = append(droppedExtensions, name)
+			}
+		}
+	}
+	return extensions, droppedExtensions, nil
+}
+
+func (m *Manager) secretName(databaseResourceData *resourcesv1.Database) string {
+	return m.settings.SecretPrefix + "-" + databaseResourceData.Name
+}
+
+// userSecretName returns the name of the secret of an additional user. The prefix is followed by a dot rather than the
+// dash of the owner secret, and user names contain no dots, so it never equals the secret name of another resource.
+func (m *Manager) userSecretName(databaseResourceData *resourcesv1.Database, name string) string {
+	return m.settings.SecretPrefix + "." + databaseResourceData.Name + "." + name
+}
+
+// deletionPolicy returns the deletion policy of the resource, falling back to the operator default.
+func (m *Manager) deletionPolicy(databaseResourceData *resourcesv1.Database) (database.DeletionPolicy, error) {
+	deletionPolicy := databaseResourceData.Spec.DeletionPolicy
+	if deletionPolicy == "" {
+		deletionPolicy = string(m.settings.DefaultDeletionPolicy)
+	}
+	if !slices.Contains(database.ListDeletionPolicies(), deletionPolicy) {
+		return "", helper.Permanent(fmt.Errorf("unknown deletion policy: %s", deletionPolicy))
+	}
+	return database.DeletionPolicy(deletionPolicy), nil
+}
@@ -0,0 +1,183 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"external-db-operator/internal/database"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+func TestResourceLimits(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		limits      *resourcesv1.ResourceLimits
+		expected    database.Limits
+		expectError bool
+	}{
+		{name: "no limits", limits: nil, expected: database.Limits{}},
+		{
+			name: "all limits",
+			limits: &resourcesv1.ResourceLimits{
+				ConnectionLimit: 10, StatementTimeout: "30s", IdleInTransactionSessionTimeout: "5m",
+				MaxQueriesPerHour: 1000, MaxUpdatesPerHour: 100, MaxConnectionsPerHour: 50,
+			},
+			expected: database.Limits{
+				ConnectionLimit: 10, StatementTimeout: 30 * time.Second, IdleInTransactionSessionTimeout: 5 * time.Minute,
+				MaxQueriesPerHour: 1000, MaxUpdatesPerHour: 100, MaxConnectionsPerHour: 50,
+			},
+		},
+		{name: "invalid timeout", limits: &resourcesv1.ResourceLimits{StatementTimeout: "30"}, expectError: true},
+		{name: "negative timeout", limits: &resourcesv1.ResourceLimits{IdleInTransactionSessionTimeout: "-1s"}, expectError: true},
+		{name: "negative connection limit", limits: &resourcesv1.ResourceLimits{ConnectionLimit: -1}, expectError: true},
+		{name: "negative hourly limit", limits: &resourcesv1.ResourceLimits{MaxQueriesPerHour: -1}, expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			limits, limitsError := resourceLimits(&resourcesv1.Database{Spec: resourcesv1.DatabaseSpec{Limits: testCase.limits}})
+			if testCase.expectError {
+				assert.Error(t, limitsError)
+				return
+			}
+			assert.NoError(t, limitsError)
+			assert.Equal(t, testCase.expected, limits)
+		})
+	}
+}
+
+func TestResourceExtensions(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		postgres        *resourcesv1.PostgresSpec
+		managed         []string
+		expected        []database.Extension
+		expectedDropped []string
+		expectError     bool
+	}{
+		{name: "no postgres spec", postgres: nil, managed: []string{"pgcrypto"}},
+		{
+			name:     "extensions with versions",
+			postgres: &resourcesv1.PostgresSpec{Extensions: []resourcesv1.PostgresExtension{{Name: "pgcrypto"}, {Name: "postgis", Version: "3.4.0"}}},
+			expected: []database.Extension{{Name: "pgcrypto"}, {Name: "postgis", Version: "3.4.0"}},
+		},
+		{
+			name:     "removed extensions are kept",
+			postgres: &resourcesv1.PostgresSpec{Extensions: []resourcesv1.PostgresExtension{{Name: "pgcrypto"}}},
+			managed:  []string{"pgcrypto", "hstore"},
+			expected: []database.Extension{{Name: "pgcrypto"}},
+		},
+		{
+			name:            "removed extensions are dropped on request",
+			postgres:        &resourcesv1.PostgresSpec{Extensions: []resourcesv1.PostgresExtension{{Name: "pgcrypto"}}, DropRemovedExtensions: true},
+			managed:         []string{"pgcrypto", "hstore"},
+			expected:        []database.Extension{{Name: "pgcrypto"}},
+			expectedDropped: []string{"hstore"},
+		},
+		{name: "empty name", postgres: &resourcesv1.PostgresSpec{Extensions: []resourcesv1.PostgresExtension{{Name: ""}}}, expectError: true},
+		{
+			name:        "duplicate extension",
+			postgres:    &resourcesv1.PostgresSpec{Extensions: []resourcesv1.PostgresExtension{{Name: "pgcrypto"}, {Name: "pgcrypto"}}},
+			expectError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			extensions, dropped, extensionsError := resourceExtensions(&resourcesv1.Database{
+				Spec:   resourcesv1.DatabaseSpec{Postgres: testCase.postgres},
+				Status: resourcesv1.DatabaseStatus{Extensions: testCase.managed},
+			})
+			if testCase.expectError {
+				assert.Error(t, extensionsError)
+				return
+			}
+			assert.NoError(t, extensionsError)
+			assert.Equal(t, testCase.expected, extensions)
+			assert.Equal(t, testCase.expectedDropped, dropped)
+		})
+	}
+}
+
+func TestOwnsSecret(t *testing.T) {
+	resource := &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "team-a", UID: "foo"}}
+	for _, testCase := range []struct {
+		name         string
+		references   []metav1.OwnerReference
+		ownsUnmarked bool
+		expected     bool
+	}{
+		{name: "owned", references: []metav1.OwnerReference{ownerReference(resource)}, expected: true},
+		{name: "owned by another resource", references: []metav1.OwnerReference{{Kind: resourcesv1.DatabaseKind, Name: "foo-reporting", UID: "foo-reporting"}}, ownsUnmarked: true, expected: false},
+		{name: "unmarked secret of a previous operator version", ownsUnmarked: true, expected: true},
+		{name: "unmarked secret of colliding names", ownsUnmarked: false, expected: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			secretData := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "edb-foo", Namespace: "team-a", OwnerReferences: testCase.references}}
+			assert.Equal(t, testCase.expected, ownsSecret(resource, secretData, testCase.ownsUnmarked))
+		})
+	}
+}
+
+func TestUserSecretName(t *testing.T) {
+	m := &Manager{settings: Settings{SecretPrefix: "edb"}}
+	owner := &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}
+	other := &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "foo-reporting"}}
+	assert.Equal(t, "edb.foo.reporting", m.userSecretName(owner, "reporting"))
+	assert.NotEqual(t, m.secretName(other), m.userSecretName(owner, "reporting"))
+}
+
+func TestSecretUpToDate(t *testing.T) {
+	resource := &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "team-a", UID: "shop"}}
+	rendered := func() *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "edb-shop",
+				Labels:          map[string]string{"bonsai-oss.org/external-db-operator": "postgres-default"},
+				OwnerReferences: []metav1.OwnerReference{ownerReference(resource)},
+			},
+			StringData: map[string]string{"username": "shop", "password": "secret"},
+		}
+	}
+	existing := func() *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "edb-shop",
+				Namespace:       "team-a",
+				ResourceVersion: "42",
+				Labels:          map[string]string{"bonsai-oss.org/external-db-operator": "postgres-default"},
+				OwnerReferences: []metav1.OwnerReference{ownerReference(resource)},
+			},
+			Data: map[string][]byte{"username": []byte("shop"), "password": []byte("secret")},
+		}
+	}
+
+	for _, testCase := range []struct {
+		name     string
+		modify   func(existingSecret *corev1.Secret)
+		expected bool
+	}{
+		{name: "unchanged", modify: func(*corev1.Secret) {}, expected: true},
+		{name: "changed value", modify: func(existingSecret *corev1.Secret) {
+			existingSecret.Data["password"] = []byte("previous")
+		}, expected: false},
+		{name: "superfluous key", modify: func(existingSecret *corev1.Secret) {
+			existingSecret.Data["uri"] = []byte("postgres://shop")
+		}, expected: false},
+		{name: "missing key", modify: func(existingSecret *corev1.Secret) {
+			delete(existingSecret.Data, "password")
+		}, expected: false},
+		{name: "changed labels", modify: func(existingSecret *corev1.Secret) {
+			existingSecret.Labels = nil
+		}, expected: false},
+		{name: "missing owner reference", modify: func(existingSecret *corev1.Secret) {
+			existingSecret.OwnerReferences = nil
+		}, expected: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			existingSecret := existing()
+			testCase.modify(existingSecret)
+			assert.Equal(t, testCase.expected, secretUpToDate(existingSecret, rendered()))
+		})
+	}
+}
@@ -2,22 +2,63 @@ package lifecycle
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 
 	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
 	"external-db-operator/internal/metrics"
+	"external-db-operator/internal/naming"
+	"external-db-operator/internal/password"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+	"external-db-operator/internal/secret"
 )
 
 type Manager struct {
-	Events       chan watch.Event
-	clients      Clients
-	secretPrefix string
+	clients  Clients
+	settings Settings
+
+	informerFactory dynamicinformer.DynamicSharedInformerFactory
+	informer        cache.SharedIndexInformer
+	lister          cache.GenericLister
+	// selector matches the label of this operator instance.
+	selector labels.Selector
+	queue    workqueue.TypedRateLimitingInterface[string]
+
+	serverInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	serverInformer        cache.SharedIndexInformer
+	serverLister          cache.GenericLister
+	// servers holds the providers connected to DatabaseServers, by server name.
+	servers      map[string]*serverProvider
+	serversMutex sync.Mutex
+
+	// claimsMutex serializes the name resolution of new resources across workers. claims holds the resources whose
+	// names have been pinned, until the informer cache reflects them.
+	claimsMutex sync.Mutex
+	claims      sync.Map
+
+	eventBroadcaster record.EventBroadcaster
+	recorder         record.EventRecorder
 }
 
 type Clients struct {
@@ -26,40 +67,354 @@ type Clients struct {
 	Database          database.Provider
 }
 
-func NewManager(clients Clients, secretPrefix string) *Manager {
+type Settings struct {
+	// SecretPrefix is prepended to the name of every secret created by the operator.
+	SecretPrefix string
+	// PasswordPolicy shapes all generated passwords. Fields set in the resource password policy take precedence.
+	PasswordPolicy password.Policy
+	// SecretTemplate renders additional keys of every secret. Keys of the resource secret template take precedence.
+	SecretTemplate *secret.Template
+	// DatabaseNameTemplate and UserNameTemplate render the names of newly provisioned databases and users.
+	DatabaseNameTemplate *naming.Template
+	UserNameTemplate     *naming.Template
+	// AllowNameOverrides permits resources to choose their names through the spec instead of the operator templates.
+	AllowNameOverrides bool
+	// LabelSelector selects the database resources handled by this operator instance.
+	LabelSelector string
+	// InstanceName selects the DatabaseServers, whose database resources without an instance label are handled by
+	// this operator instance.
+	InstanceName string
+	// ResyncPeriod is the interval in which all known database resources are reconciled again.
+	ResyncPeriod time.Duration
+	// MaxRetries limits how often a resource is requeued after a transient error, before giving up until the next resync.
+	MaxRetries int
+	// DefaultDeletionPolicy applies to all database resources without an explicit deletion policy.
+	DefaultDeletionPolicy database.DeletionPolicy
+	// SnapshotDirectory keeps the logical dumps of databases deleted with the Snapshot deletion policy, in a directory
+	// per namespace. Snapshots are disabled if empty.
+	SnapshotDirectory string
+	// SnapshotRetention is the age after which snapshots are removed, zero keeps them forever.
+	SnapshotRetention time.Duration
+	// Workers is the number of resources reconciled concurrently. A single resource is never reconciled twice at a time.
+	Workers int
+	// DatabaseTimeout bounds every single operation on a database server, zero disables the timeout.
+	DatabaseTimeout time.Duration
+	// Pool shapes the connection pools to DatabaseServers, unless a server sets its own.
+	Pool database.PoolSettings
+	// DefaultAllowedHosts restricts the hosts users may connect from, unless the resource lists its own hosts (mysql).
+	DefaultAllowedHosts []string
+}
+
+const (
+	// eventSourceComponent is reported as source of all kubernetes events recorded by the operator.
+	eventSourceComponent = "external-db-operator"
+
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+func NewManager(clients Clients, settings Settings) *Manager {
 	if clients.Kubernetes == nil {
 		panic("kubernetes client is required")
 	}
 	if clients.KubernetesDynamic == nil {
 		panic("kubernetes dynamic client is required")
 	}
-	if clients.Database == nil {
-		panic("database provider is required")
-	}
-	if secretPrefix == "" {
+	if settings.SecretPrefix == "" {
 		panic("secret prefix is required")
 	}
-	return &Manager{
-		Events:       make(chan watch.Event),
-		clients:      clients,
-		secretPrefix: secretPrefix,
+	if settings.DatabaseNameTemplate == nil || settings.UserNameTemplate == nil {
+		panic("naming templates are required")
+	}
+	if settings.SecretTemplate == nil {
+		panic("secret template is required")
+	}
+	selector, parseError := labels.Parse(settings.LabelSelector)
+	if parseError != nil || selector.Empty() {
+		panic("label selector is required")
+	}
+
+	// resources referring to a DatabaseServer may lack the instance label, so all resources are watched and filtered
+	// when they are enqueued
+	informerFactory := dynamicinformer.NewDynamicSharedInformerFactory(clients.KubernetesDynamic, settings.ResyncPeriod)
+	genericInformer := informerFactory.ForResource(resourcesv1.DatabaseResource)
+	// servers are cluster scoped and shared by all operator instances, so they are not filtered by the label selector
+	serverInformerFactory := dynamicinformer.NewDynamicSharedInformerFactory(clients.KubernetesDynamic, settings.ResyncPeriod)
+	serverInformer := serverInformerFactory.ForResource(resourcesv1.DatabaseServerResource)
+
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clients.Kubernetes.CoreV1().Events(metav1.NamespaceAll)})
+
+	m := &Manager{
+		clients:         clients,
+		settings:        settings,
+		informerFactory: informerFactory,
+		informer:        genericInformer.Informer(),
+		lister:          genericInformer.Lister(),
+		selector:        selector,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[string](retryBaseDelay, retryMaxDelay),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "databases"},
+		),
+		serverInformerFactory: serverInformerFactory,
+		serverInformer:        serverInformer.Informer(),
+		serverLister:          serverInformer.Lister(),
+		servers:               map[string]*serverProvider{},
+		eventBroadcaster:      eventBroadcaster,
+		recorder:              eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventSourceComponent}),
+	}
+
+	_, _ = m.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			m.enqueueHandled(obj)
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			m.forgetClaims(newObj.(*unstructured.Unstructured))
+			if isStatusUpdate(oldObj.(*unstructured.Unstructured), newObj.(*unstructured.Unstructured)) {
+				return
+			}
+			m.enqueueHandled(newObj)
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, isTombstone := obj.(cache.DeletedFinalStateUnknown); isTombstone {
+				obj = tombstone.Obj
+			}
+			if object, isObject := obj.(*unstructured.Unstructured); isObject {
+				m.claims.Delete(object.GetUID())
+			}
+		},
+	})
+	_, _ = m.serverInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			m.handleServerChange(nil, obj)
+		},
+		UpdateFunc: m.handleServerChange,
+		DeleteFunc: m.handleServerDeletion,
+	})
+
+	return m
+}
+
+func (m *Manager) enqueue(obj any) {
+	key, keyError := cache.MetaNamespaceKeyFunc(obj)
+	if keyError != nil {
+		slog.Error("failed to build object key", slog.String("error", keyError.Error()))
+		return
+	}
+	m.queue.Add(key)
+}
+
+// enqueueHandled enqueues the resource, if it is handled by this operator instance. Resources referring to a
+// DatabaseServer not in the informer cache yet are enqueued once the server shows up.
+func (m *Manager) enqueueHandled(obj any) {
+	databaseResourceData, convertError := resourcesv1.FromUnstructured(obj.(*unstructured.Unstructured).Object)
+	if convertError != nil {
+		slog.Error("failed to convert unstructured object", slog.String("error", convertError.Error()))
+		return
 	}
+	if m.handles(databaseResourceData) {
+		m.enqueue(obj)
+	}
+}
+
+// isStatusUpdate reports whether an update only touched the status of a resource, which has been written by the operator itself.
+func isStatusUpdate(oldObject, newObject *unstructured.Unstructured) bool {
+	return oldObject.GetResourceVersion() != newObject.GetResourceVersion() &&
+		oldObject.GetGeneration() == newObject.GetGeneration() &&
+		equality.Semantic.DeepEqual(oldObject.GetLabels(), newObject.GetLabels()) &&
+		equality.Semantic.DeepEqual(oldObject.GetAnnotations(), newObject.GetAnnotations()) &&
+		equality.Semantic.DeepEqual(oldObject.GetFinalizers(), newObject.GetFinalizers()) &&
+		equality.Semantic.DeepEqual(oldObject.GetDeletionTimestamp(), newObject.GetDeletionTimestamp())
 }
 
+// Run starts the informer and processes the work queue with the configured number of workers until the context is
+// cancelled. Cancelling the context aborts the running reconciliations, Run returns once all of them have been stopped.
 func (m *Manager) Run(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case event := <-m.Events:
-			start := time.Now()
-			handlingError := m.handleEvent(event)
-			if handlingError != nil {
-				slog.Error("failed to handle event", slog.String("error", handlingError.Error()))
+	defer m.eventBroadcaster.Shutdown()
+	defer m.closeServerProviders()
+	defer m.queue.ShutDown()
+
+	m.informerFactory.Start(ctx.Done())
+	m.serverInformerFactory.Start(ctx.Done())
+	slog.Info("waiting for informer cache to sync")
+	if !cache.WaitForCacheSync(ctx.Done(), m.informer.HasSynced, m.serverInformer.HasSynced) {
+		slog.Error("failed to sync informer cache")
+		return
+	}
+
+	go m.runSnapshotPruning(ctx)
+
+	var workers sync.WaitGroup
+	for range max(m.settings.Workers, 1) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for m.processNextItem(ctx) {
 			}
-			metrics.EventProcessing.With(prometheus.Labels{
-				"event_type": string(event.Type),
-			}).Observe(time.Since(start).Seconds())
+		}()
+	}
+
+	<-ctx.Done()
+	m.queue.ShutDown()
+	workers.Wait()
+}
+
+func (m *Manager) processNextItem(ctx context.Context) bool {
+	key, shutdown := m.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer m.queue.Done(key)
+
+	start := time.Now()
+	eventType, handlingError := m.reconcile(ctx, key)
+	metrics.EventProcessing.With(prometheus.Labels{
+		"event_type": string(eventType),
+	}).Observe(time.Since(start).Seconds())
+
+	if handlingError != nil {
+		m.handleError(key, handlingError)
+		return true
+	}
+
+	m.queue.Forget(key)
+	return true
+}
+
+// handleError requeues the resource with exponential backoff, unless the error is permanent or the retry limit is reached.
+func (m *Manager) handleError(key string, handlingError error) {
+	if helper.IsPermanentError(handlingError) {
+		metrics.ReconcileErrors.With(prometheus.Labels{"classification": "permanent"}).Inc()
+		slog.Error("failed to handle event, not retrying", slog.String("key", key), slog.String("error", handlingError.Error()))
+		m.queue.Forget(key)
+		return
+	}
+
+	metrics.ReconcileErrors.With(prometheus.Labels{"classification": "transient"}).Inc()
+	if retries := m.queue.NumRequeues(key); retries < m.settings.MaxRetries {
+		slog.Warn("failed to handle event, retrying", slog.String("key", key), slog.Int("retries", retries), slog.String("error", handlingError.Error()))
+		m.queue.AddRateLimited(key)
+		return
+	}
+
+	metrics.ReconcileRetriesExhausted.Inc()
+	slog.Error("failed to handle event, retry limit reached", slog.String("key", key), slog.String("error", handlingError.Error()))
+	m.queue.Forget(key)
+}
+
+// reconcile looks up the current state of the given resource and hands it over to the event handler.
+// Resources marked for deletion are handled as deletion, as long as they still carry the operator finalizer.
+func (m *Manager) reconcile(ctx context.Context, key string) (watch.EventType, error) {
+	namespace, name, splitKeyError := cache.SplitMetaNamespaceKey(key)
+	if splitKeyError != nil {
+		return watch.Error, splitKeyError
+	}
+
+	cachedObject, getObjectError := m.lister.ByNamespace(namespace).Get(name)
+	if apierrors.IsNotFound(getObjectError) {
+		// the resource is gone for good, its cleanup has been done before the finalizer was removed
+		return watch.Deleted, nil
+	}
+	if getObjectError != nil {
+		return watch.Error, getObjectError
+	}
+	object := cachedObject.(*unstructured.Unstructured).DeepCopy()
+
+	databaseResourceData, convertError := resourcesv1.FromUnstructured(object.Object)
+	if convertError != nil {
+		return watch.Error, helper.Permanent(fmt.Errorf("failed to convert unstructured object: %w", convertError))
+	}
+	if !m.handles(databaseResourceData) {
+		// the resource has been handed over to another operator instance since it was enqueued
+		return watch.Modified, nil
+	}
+
+	if object.GetDeletionTimestamp() != nil {
+		if !hasFinalizer(object) {
+			return watch.Deleted, nil
+		}
+		provider, handlingError := m.provider(ctx, databaseResourceData)
+		if (errors.As(handlingError, &ErrServerNotFound{}) || errors.Is(handlingError, ErrNoDefaultServer)) && databaseResourceData.Status.DatabaseName == "" {
+			// nothing has been provisioned on a server which never existed
+			return watch.Deleted, m.removeFinalizer(ctx, object)
 		}
+		var names resourceNames
+		if handlingError == nil {
+			names, handlingError = m.resolveNames(ctx, databaseResourceData, provider, false)
+			if errors.As(handlingError, &ErrNameCollision{}) {
+				// the names belong to another resource, which must not be affected
+				names, handlingError = resourceNames{}, nil
+			}
+		}
+		if handlingError == nil && !names.IsEmpty() {
+			var markedObject *unstructured.Unstructured
+			if markedObject, handlingError = m.markSnapshot(ctx, object, names); handlingError == nil {
+				object = markedObject
+			}
+		}
+		if handlingError == nil {
+			_, handlingError = m.handleEvent(ctx, watch.Event{Type: watch.Deleted, Object: object}, names, provider)
+		}
+		if handlingError != nil {
+			m.recorder.Event(object, corev1.EventTypeWarning, "DeletionFailed", handlingError.Error())
+			return watch.Deleted, errors.Join(handlingError, m.recordResult(ctx, object, eventOutcome{}, handlingError))
+		}
+		return watch.Deleted, m.removeFinalizer(ctx, object)
+	}
+
+	if !hasFinalizer(object) {
+		var addFinalizerError error
+		if object, addFinalizerError = m.addFinalizer(ctx, object); addFinalizerError != nil {
+			return watch.Modified, addFinalizerError
+		}
+	}
+
+	provider, providerError := m.provider(ctx, databaseResourceData)
+	if providerError != nil {
+		m.recorder.Event(object, corev1.EventTypeWarning, "ReconcileFailed", providerError.Error())
+		return watch.Modified, errors.Join(providerError, m.recordResult(ctx, object, eventOutcome{}, providerError))
+	}
+
+	// new resources claim their names one at a time, so concurrent workers never hand out a name twice
+	newResource := databaseResourceData.Status.DatabaseName == ""
+	if newResource {
+		m.claimsMutex.Lock()
 	}
+	names, resolveNamesError := m.resolveNames(ctx, databaseResourceData, provider, true)
+	var markProvisioningError error
+	if resolveNamesError == nil {
+		// pin the names before anything gets created, so they stay the same for the whole lifetime of the resource
+		object, markProvisioningError = m.markProvisioning(ctx, object, names)
+		if newResource && markProvisioningError == nil {
+			m.rememberClaims(object)
+		}
+	}
+	if newResource {
+		m.claimsMutex.Unlock()
+	}
+	if resolveNamesError != nil {
+		m.recorder.Event(object, corev1.EventTypeWarning, "ReconcileFailed", resolveNamesError.Error())
+		return watch.Modified, errors.Join(resolveNamesError, m.recordResult(ctx, object, eventOutcome{}, resolveNamesError))
+	}
+	if markProvisioningError != nil {
+		return watch.Modified, markProvisioningError
+	}
+	markedObject, markUsersError := m.markUsers(ctx, object, provider, names)
+	if markUsersError != nil {
+		m.recorder.Event(object, corev1.EventTypeWarning, "ReconcileFailed", markUsersError.Error())
+		return watch.Modified, errors.Join(markUsersError, m.recordResult(ctx, object, eventOutcome{}, markUsersError))
+	}
+	object = markedObject
+
+	outcome, handlingError := m.handleEvent(ctx, watch.Event{Type: watch.Modified, Object: object}, names, provider)
+	if handlingError != nil {
+		m.recorder.Event(object, corev1.EventTypeWarning, "ReconcileFailed", handlingError.Error())
+		return watch.Modified, errors.Join(handlingError, m.recordResult(ctx, object, outcome, handlingError))
+	}
+	if recordResultError := m.recordResult(ctx, object, outcome, nil); recordResultError != nil {
+		return watch.Modified, recordResultError
+	}
+
+	m.schedulePasswordRotation(key, databaseResourceData, outcome)
+	return watch.Modified, m.clearPasswordRotationRequest(ctx, object)
 }
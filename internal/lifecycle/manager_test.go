@@ -0,0 +1,59 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestIsStatusUpdate(t *testing.T) {
+	base := func() *unstructured.Unstructured {
+		object := &unstructured.Unstructured{}
+		object.SetResourceVersion("1")
+		object.SetGeneration(1)
+		object.SetLabels(map[string]string{"bonsai-oss.org/external-db-operator": "default"})
+		object.SetAnnotations(map[string]string{"team": "a"})
+		object.SetFinalizers([]string{FinalizerName})
+		return object
+	}
+	for _, testCase := range []struct {
+		name     string
+		modify   func(object *unstructured.Unstructured)
+		expected bool
+	}{
+		{name: "status only", modify: func(object *unstructured.Unstructured) {
+			object.SetResourceVersion("2")
+			_ = unstructured.SetNestedField(object.Object, "app", "status", "databaseName")
+		}, expected: true},
+		{name: "resync without change", modify: func(object *unstructured.Unstructured) {}, expected: false},
+		{name: "spec changed", modify: func(object *unstructured.Unstructured) {
+			object.SetResourceVersion("2")
+			object.SetGeneration(2)
+		}, expected: false},
+		{name: "labels changed", modify: func(object *unstructured.Unstructured) {
+			object.SetResourceVersion("2")
+			object.SetLabels(map[string]string{"bonsai-oss.org/external-db-operator": "other"})
+		}, expected: false},
+		{name: "annotations changed", modify: func(object *unstructured.Unstructured) {
+			object.SetResourceVersion("2")
+			object.SetAnnotations(map[string]string{"bonsai-oss.org/rotate-password": ""})
+		}, expected: false},
+		{name: "finalizer removed", modify: func(object *unstructured.Unstructured) {
+			object.SetResourceVersion("2")
+			object.SetFinalizers(nil)
+		}, expected: false},
+		{name: "deletion requested", modify: func(object *unstructured.Unstructured) {
+			object.SetResourceVersion("2")
+			now := metav1.Now()
+			object.SetDeletionTimestamp(&now)
+		}, expected: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			newObject := base()
+			testCase.modify(newObject)
+			assert.Equal(t, testCase.expected, isStatusUpdate(base(), newObject))
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	"external-db-operator/internal/naming"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// resourceNames holds the names of the objects managed on the database server for a single resource.
+type resourceNames struct {
+	Database string
+	User     string
+}
+
+func (n resourceNames) IsEmpty() bool {
+	return n.Database == "" && n.User == ""
+}
+
+// ErrNameCollision is returned if the names of a resource are already claimed by another resource.
+type ErrNameCollision struct {
+	Name  string
+	Owner string
+}
+
+func (e ErrNameCollision) Error() string {
+	return fmt.Sprintf("name %s is already used by %s", e.Name, e.Owner)
+}
+
+// ErrNameOverrideDisabled is returned if a resource requests its own names, but the operator does not allow it.
+var ErrNameOverrideDisabled = errors.New("name overrides are disabled for this operator instance")
+
+// resolveNames determines the database and user name of the resource. Once provisioned, the names are pinned in the status.
+// Resources provisioned by operator versions without status are recognized by their secret and keep the legacy names,
+// which the server truncated to its identifier limit. Only a secret written by the operator for exactly these names
+// counts, see isLegacySecret. New resources get their names rendered from the naming templates.
+// If generate is false, empty names are returned for resources which have never been provisioned.
+func (m *Manager) resolveNames(ctx context.Context, databaseResourceData *resourcesv1.Database, provider database.Provider, generate bool) (resourceNames, error) {
+	if databaseResourceData.Status.DatabaseName != "" && databaseResourceData.Status.Username != "" {
+		names := resourceNames{Database: databaseResourceData.Status.DatabaseName, User: databaseResourceData.Status.Username}
+		if generate {
+			if overrideError := verifyNameOverrides(databaseResourceData, names); overrideError != nil {
+				return resourceNames{}, overrideError
+			}
+			if serverError := verifyServerRef(databaseResourceData); serverError != nil {
+				return resourceNames{}, serverError
+			}
+		}
+		return names, nil
+	}
+
+	namingRules := provider.NamingRules()
+
+	existingSecret, getSecretError := m.clients.Kubernetes.CoreV1().Secrets(databaseResourceData.Namespace).Get(ctx, m.secretName(databaseResourceData), metav1.GetOptions{})
+	if getSecretError != nil && !apierrors.IsNotFound(getSecretError) {
+		return resourceNames{}, fmt.Errorf("failed to get secret: %w", classifyKubernetesError(getSecretError))
+	}
+
+	baseName := databaseResourceData.AssembleDatabaseName()
+	names := resourceNames{
+		Database: baseName[:min(len(baseName), namingRules.MaxDatabaseNameLength)],
+		User:     baseName[:min(len(baseName), namingRules.MaxUserNameLength)],
+	}
+	adopt := getSecretError == nil && m.isLegacySecret(databaseResourceData, existingSecret, names)
+	switch {
+	case adopt:
+	case generate:
+		var renderError error
+		if names, renderError = m.renderNames(databaseResourceData, namingRules); renderError != nil {
+			return resourceNames{}, renderError
+		}
+	default:
+		return resourceNames{}, nil
+	}
+
+	if validationError := namingRules.ValidateDatabaseName(names.Database); validationError != nil {
+		return resourceNames{}, helper.Permanent(validationError)
+	}
+	if validationError := namingRules.ValidateUserName(names.User); validationError != nil {
+		return resourceNames{}, helper.Permanent(validationError)
+	}
+	newNames := claimedNames{databases: []string{names.Database}, users: []string{names.User}, secrets: []string{m.secretName(databaseResourceData)}}
+	if adopt {
+		// the database and user of legacy resources exist on the server already and are adopted
+		if collisionError := m.checkClaimedNames(databaseResourceData, newNames); collisionError != nil {
+			return resourceNames{}, collisionError
+		}
+		return names, nil
+	}
+	if collisionError := m.checkNewNames(ctx, databaseResourceData, provider, newNames); collisionError != nil {
+		return resourceNames{}, collisionError
+	}
+
+	return names, nil
+}
+
+// isLegacySecret reports whether the secret has been written for the resource by an operator version without status.
+// Those secrets carry the labels of the resource, including the one selecting this operator instance, as well as the
+// legacy names. A secret owned by anything else, or created by hand for other names, never leads to an adoption.
+func (m *Manager) isLegacySecret(databaseResourceData *resourcesv1.Database, secretData *corev1.Secret, names resourceNames) bool {
+	if !ownsSecret(databaseResourceData, secretData, true) {
+		return false
+	}
+	if m.selector == nil || !m.selector.Matches(labels.Set(secretData.Labels)) {
+		return false
+	}
+	return string(secretData.Data["database"]) == names.Database && string(secretData.Data["username"]) == names.User
+}
+
+// renderNames renders the names of a new resource. Names from the operator templates are shortened to the server limits,
+// while names requested through the spec are used as they are.
+func (m *Manager) renderNames(databaseResourceData *resourcesv1.Database, namingRules database.NamingRules) (resourceNames, error) {
+	data := naming.NewData(databaseResourceData.Namespace, databaseResourceData.Name)
+
+	databaseName, renderError := m.renderName(m.settings.DatabaseNameTemplate, databaseResourceData.Spec.DatabaseName, data, namingRules.MaxDatabaseNameLength)
+	if renderError != nil {
+		return resourceNames{}, renderError
+	}
+	data.DatabaseName = databaseName
+
+	userName, renderError := m.renderName(m.settings.UserNameTemplate, databaseResourceData.Spec.Username, data, namingRules.MaxUserNameLength)
+	if renderError != nil {
+		return resourceNames{}, renderError
+	}
+
+	return resourceNames{Database: databaseName, User: userName}, nil
+}
+
+func (m *Manager) renderName(operatorTemplate *naming.Template, override string, data naming.Data, maxLength int) (string, error) {
+	if override == "" {
+		name, renderError := operatorTemplate.Render(data)
+		if renderError != nil {
+			return "", helper.Permanent(renderError)
+		}
+		return database.ShortenName(name, maxLength), nil
+	}
+
+	if !m.settings.AllowNameOverrides {
+		return "", helper.Permanent(ErrNameOverrideDisabled)
+	}
+	return renderOverride(override, data)
+}
+
+func renderOverride(override string, data naming.Data) (string, error) {
+	overrideTemplate, parseError := naming.Parse(override)
+	if parseError != nil {
+		return "", helper.Permanent(parseError)
+	}
+	name, renderError := overrideTemplate.Render(data)
+	if renderError != nil {
+		return "", helper.Permanent(renderError)
+	}
+	return name, nil
+}
+
+// verifyNameOverrides rejects spec overrides which no longer match the pinned names of a provisioned resource.
+func verifyNameOverrides(databaseResourceData *resourcesv1.Database, names resourceNames) error {
+	data := naming.NewData(databaseResourceData.Namespace, databaseResourceData.Name)
+	data.DatabaseName = names.Database
+	for _, override := range []struct{ property, template, pinned string }{
+		{property: "databaseName", template: databaseResourceData.Spec.DatabaseName, pinned: names.Database},
+		{property: "username", template: databaseResourceData.Spec.Username, pinned: names.User},
+	} {
+		if override.template == "" {
+			continue
+		}
+		name, renderError := renderOverride(override.template, data)
+		if renderError != nil {
+			return renderError
+		}
+		if name != override.pinned {
+			return helper.Permanent(database.ErrImmutableProperty{Property: override.property, Current: override.pinned, Requested: name})
+		}
+	}
+
+	return nil
+}
+
+// verifyServerRef rejects a server reference, which no longer matches the pinned server of a provisioned resource.
+func verifyServerRef(databaseResourceData *resourcesv1.Database) error {
+	var requested string
+	if databaseResourceData.Spec.ServerRef != nil {
+		requested = databaseResourceData.Spec.ServerRef.Name
+	}
+	if pinned := databaseResourceData.Status.ServerName; requested != pinned {
+		return helper.Permanent(database.ErrImmutableProperty{Property: "serverRef", Current: pinned, Requested: requested})
+	}
+	return nil
+}
+
+// claimedNames are the names of the objects a resource manages on the database server and in its namespace.
+type claimedNames struct {
+	databases []string
+	users     []string
+	secrets   []string
+}
+
+// checkClaimedNames ensures none of the names is claimed by another resource. The logins of a dual user rotation and
+// additional users are claimed user names as well. Database and user names are only claimed on the same database
+// server, secret names only within the namespace.
+func (m *Manager) checkClaimedNames(databaseResourceData *resourcesv1.Database, names claimedNames) error {
+	objects, listError := m.lister.List(labels.Everything())
+	if listError != nil {
+		return fmt.Errorf("failed to list database resources: %w", listError)
+	}
+
+	for _, object := range objects {
+		other := object.(*unstructured.Unstructured)
+		if other.GetUID() == databaseResourceData.UID {
+			continue
+		}
+		owner := other.GetNamespace() + "/" + other.GetName()
+
+		otherData, convertError := resourcesv1.FromUnstructured(other.Object)
+		if convertError != nil {
+			continue
+		}
+		if claimed, found := m.claims.Load(other.GetUID()); found {
+			// the names have been pinned by another worker, but the informer cache does not reflect them yet
+			otherData = claimed.(*resourcesv1.Database)
+		}
+		var claimedDatabaseNames, claimedUserNames []string
+		// the default servers of other operator instances are distinct servers
+		onDefaultServerOfOtherInstance := m.hasInstanceLabel(otherData.Labels) && !m.selector.Matches(labels.Set(otherData.Labels))
+		if serverName(otherData) == serverName(databaseResourceData) && (serverName(otherData) != "" || !onDefaultServerOfOtherInstance) {
+			claimedDatabaseNames = []string{otherData.Status.DatabaseName}
+			claimedUserNames = slices.Concat([]string{otherData.Status.Username}, otherData.Status.Logins, additionalUsernames(otherData.Status.Users))
+		}
+		var claimedSecretNames []string
+		if otherData.Namespace == databaseResourceData.Namespace {
+			claimedSecretNames = append(claimedSecretNames, otherData.Status.SecretName)
+			for _, user := range otherData.Status.Users {
+				claimedSecretNames = append(claimedSecretNames, user.SecretName)
+			}
+		}
+
+		for _, candidate := range []struct {
+			names   []string
+			claimed []string
+		}{
+			{names: names.databases, claimed: claimedDatabaseNames},
+			{names: names.users, claimed: claimedUserNames},
+			{names: names.secrets, claimed: claimedSecretNames},
+		} {
+			for _, name := range candidate.names {
+				if slices.ContainsFunc(candidate.claimed, func(claimedName string) bool { return claimedName != "" && strings.EqualFold(claimedName, name) }) {
+					return helper.Permanent(ErrNameCollision{Name: name, Owner: owner})
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkNewNames ensures the names about to be pinned for the resource are neither claimed by another resource nor
+// exist on the database server already.
+func (m *Manager) checkNewNames(ctx context.Context, databaseResourceData *resourcesv1.Database, provider database.Provider, names claimedNames) error {
+	if collisionError := m.checkClaimedNames(databaseResourceData, names); collisionError != nil {
+		return collisionError
+	}
+	return m.checkExistingNames(ctx, provider, names)
+}
+
+// checkExistingNames ensures none of the names exists on the database server. Existing objects are not managed by this
+// operator instance, e.g. created by hand or by another instance sharing the server, and must never be taken over.
+func (m *Manager) checkExistingNames(ctx context.Context, provider database.Provider, names claimedNames) error {
+	for _, candidate := range []struct {
+		kind   string
+		names  []string
+		exists func(ctx context.Context, name string) (bool, error)
+	}{
+		{kind: "database", names: names.databases, exists: provider.DatabaseExists},
+		{kind: "user", names: names.users, exists: provider.UserExists},
+	} {
+		for _, name := range candidate.names {
+			existsContext, cancelExists := m.databaseContext(ctx)
+			exists, existsError := candidate.exists(existsContext, name)
+			cancelExists()
+			if existsError != nil {
+				return fmt.Errorf("failed to look up %s %s: %w", candidate.kind, name, existsError)
+			}
+			if exists {
+				return helper.Permanent(ErrNameCollision{Name: name, Owner: "an existing " + candidate.kind + " on the database server"})
+			}
+		}
+	}
+	return nil
+}
+
+// rememberClaims keeps the names pinned in the status of the resource, until the informer cache reflects the update.
+func (m *Manager) rememberClaims(object *unstructured.Unstructured) {
+	if databaseResourceData, convertError := resourcesv1.FromUnstructured(object.Object); convertError == nil {
+		m.claims.Store(object.GetUID(), databaseResourceData)
+	}
+}
+
+// forgetClaims drops the remembered names of the resource, once the informer cache reflects the update pinning them.
+func (m *Manager) forgetClaims(object *unstructured.Unstructured) {
+	if claimed, found := m.claims.Load(object.GetUID()); found && claimed.(*resourcesv1.Database).ResourceVersion == object.GetResourceVersion() {
+		m.claims.Delete(object.GetUID())
+	}
+}
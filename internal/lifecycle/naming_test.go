@@ -0,0 +1,265 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// newListerManager returns a manager listing the given resources, as the informer cache would.
+func newListerManager(t *testing.T, resources ...*resourcesv1.Database) *Manager {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, resource := range resources {
+		object, convertError := runtime.DefaultUnstructuredConverter.ToUnstructured(resource)
+		require.NoError(t, convertError)
+		require.NoError(t, indexer.Add(&unstructured.Unstructured{Object: object}))
+	}
+	return &Manager{
+		lister:   cache.NewGenericLister(indexer, resourcesv1.DatabaseResource.GroupResource()),
+		selector: labels.SelectorFromSet(labels.Set{instanceLabel: "postgres-default"}),
+	}
+}
+
+const instanceLabel = "bonsai-oss.org/external-db-operator"
+
+func TestCheckClaimedNames(t *testing.T) {
+	provisioned := &resourcesv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "team-a", UID: types.UID("shop")},
+		Status: resourcesv1.DatabaseStatus{
+			DatabaseName: "shop",
+			Username:     "shop",
+			SecretName:   "edb-shop",
+			Logins:       []string{"shop_a", "shop_b"},
+			Users:        []resourcesv1.DatabaseUserStatus{{Name: "reporting", Username: "shop_reporting", SecretName: "edb-shop-reporting"}},
+		},
+	}
+	onOtherServer := &resourcesv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "billing", Namespace: "team-b", UID: types.UID("billing")},
+		Spec:       resourcesv1.DatabaseSpec{ServerRef: &resourcesv1.ServerReference{Name: "replica"}},
+		Status:     resourcesv1.DatabaseStatus{ServerName: "replica", DatabaseName: "billing", Username: "billing", SecretName: "edb-billing"},
+	}
+	onOtherInstance := &resourcesv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: "team-c", UID: types.UID("orders"), Labels: map[string]string{instanceLabel: "mysql-default"}},
+		Status:     resourcesv1.DatabaseStatus{DatabaseName: "orders", Username: "orders", SecretName: "edb-orders"},
+	}
+	m := newListerManager(t, provisioned, onOtherServer, onOtherInstance)
+
+	for _, testCase := range []struct {
+		name          string
+		resource      *resourcesv1.Database
+		names         claimedNames
+		expectedOwner string
+	}{
+		{
+			name:     "unclaimed names",
+			resource: &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-a", UID: "new"}},
+			names:    claimedNames{databases: []string{"new"}, users: []string{"new"}, secrets: []string{"edb-new"}},
+		},
+		{
+			name:          "database name claimed",
+			resource:      &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-a", UID: "new"}},
+			names:         claimedNames{databases: []string{"SHOP"}},
+			expectedOwner: "team-a/shop",
+		},
+		{
+			name:          "login claimed as user name",
+			resource:      &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-a", UID: "new"}},
+			names:         claimedNames{users: []string{"shop_b"}},
+			expectedOwner: "team-a/shop",
+		},
+		{
+			name:          "additional user claimed",
+			resource:      &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-c", UID: "new"}},
+			names:         claimedNames{users: []string{"shop_reporting"}},
+			expectedOwner: "team-a/shop",
+		},
+		{
+			name:          "secret name claimed within the namespace",
+			resource:      &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-a", UID: "new"}},
+			names:         claimedNames{secrets: []string{"edb-shop-reporting"}},
+			expectedOwner: "team-a/shop",
+		},
+		{
+			name:     "secret name in another namespace",
+			resource: &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-c", UID: "new"}},
+			names:    claimedNames{secrets: []string{"edb-shop"}},
+		},
+		{
+			name:     "names on another server",
+			resource: &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-a", UID: "new"}},
+			names:    claimedNames{databases: []string{"billing"}, users: []string{"billing"}},
+		},
+		{
+			name:          "names on the same server",
+			resource:      &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-a", UID: "new"}, Spec: resourcesv1.DatabaseSpec{ServerRef: &resourcesv1.ServerReference{Name: "replica"}}},
+			names:         claimedNames{databases: []string{"billing"}},
+			expectedOwner: "team-b/billing",
+		},
+		{
+			name:     "names on the default server of another instance",
+			resource: &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-a", UID: "new"}},
+			names:    claimedNames{databases: []string{"orders"}, users: []string{"orders"}},
+		},
+		{
+			name:     "own names",
+			resource: provisioned,
+			names:    claimedNames{databases: []string{"shop"}, users: []string{"shop", "shop_a"}, secrets: []string{"edb-shop"}},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			claimError := m.checkClaimedNames(testCase.resource, testCase.names)
+			if testCase.expectedOwner == "" {
+				assert.NoError(t, claimError)
+				return
+			}
+			var collision ErrNameCollision
+			require.ErrorAs(t, claimError, &collision)
+			assert.Equal(t, testCase.expectedOwner, collision.Owner)
+		})
+	}
+}
+
+func TestRememberedClaims(t *testing.T) {
+	pending := &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "team-a", UID: "pending", ResourceVersion: "1"}}
+	m := newListerManager(t, pending)
+
+	// another worker pinned the names, but the informer cache does not reflect the update yet
+	pinned := &resourcesv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "team-a", UID: "pending", ResourceVersion: "2"},
+		Status:     resourcesv1.DatabaseStatus{DatabaseName: "pending", Username: "pending", SecretName: "edb-pending"},
+	}
+	object, convertError := runtime.DefaultUnstructuredConverter.ToUnstructured(pinned)
+	require.NoError(t, convertError)
+	m.rememberClaims(&unstructured.Unstructured{Object: object})
+
+	resource := &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "team-a", UID: "new"}}
+	assert.ErrorAs(t, m.checkClaimedNames(resource, claimedNames{databases: []string{"pending"}}), &ErrNameCollision{})
+
+	stale, convertError := runtime.DefaultUnstructuredConverter.ToUnstructured(pending)
+	require.NoError(t, convertError)
+	m.forgetClaims(&unstructured.Unstructured{Object: stale})
+	_, remembered := m.claims.Load(pinned.UID)
+	assert.True(t, remembered, "claims are kept while the cache is stale")
+
+	m.forgetClaims(&unstructured.Unstructured{Object: object})
+	_, remembered = m.claims.Load(pinned.UID)
+	assert.False(t, remembered, "claims are forgotten once the cache reflects them")
+}
+
+// existingProvider reports the given databases and users as existing on the database server.
+type existingProvider struct {
+	database.Provider
+	databases []string
+	users     []string
+	lookupErr error
+}
+
+func (p existingProvider) DatabaseExists(_ context.Context, name string) (bool, error) {
+	return slices.Contains(p.databases, name), p.lookupErr
+}
+
+func (p existingProvider) UserExists(_ context.Context, name string) (bool, error) {
+	return slices.Contains(p.users, name), p.lookupErr
+}
+
+func TestCheckExistingNames(t *testing.T) {
+	provider := existingProvider{databases: []string{"shop"}, users: []string{"reporting"}}
+	for _, testCase := range []struct {
+		name          string
+		provider      existingProvider
+		names         claimedNames
+		expectedOwner string
+		expectError   bool
+	}{
+		{name: "new names", provider: provider, names: claimedNames{databases: []string{"new"}, users: []string{"new"}}},
+		{
+			name:          "existing database",
+			provider:      provider,
+			names:         claimedNames{databases: []string{"shop"}, users: []string{"new"}},
+			expectedOwner: "an existing database on the database server",
+		},
+		{
+			name:          "existing user",
+			provider:      provider,
+			names:         claimedNames{databases: []string{"new"}, users: []string{"new", "reporting"}},
+			expectedOwner: "an existing user on the database server",
+		},
+		{
+			name:        "failed lookup",
+			provider:    existingProvider{lookupErr: errors.New("connection refused")},
+			names:       claimedNames{databases: []string{"new"}},
+			expectError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			existsError := (&Manager{}).checkExistingNames(context.Background(), testCase.provider, testCase.names)
+			switch {
+			case testCase.expectError:
+				assert.Error(t, existsError)
+				assert.False(t, helper.IsPermanentError(existsError), "failed lookups are retried")
+			case testCase.expectedOwner == "":
+				assert.NoError(t, existsError)
+			default:
+				var collision ErrNameCollision
+				require.ErrorAs(t, existsError, &collision)
+				assert.Equal(t, testCase.expectedOwner, collision.Owner)
+				assert.True(t, helper.IsPermanentError(existsError))
+			}
+		})
+	}
+}
+
+func TestIsLegacySecret(t *testing.T) {
+	m := &Manager{selector: labels.SelectorFromSet(labels.Set{instanceLabel: "postgres-default"})}
+	resource := &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "team-a", UID: "shop"}}
+	names := resourceNames{Database: "team_a_shop", User: "team_a_shop"}
+	legacySecret := func() *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "edb-shop", Namespace: "team-a", Labels: map[string]string{instanceLabel: "postgres-default"}},
+			Data:       map[string][]byte{"database": []byte("team_a_shop"), "username": []byte("team_a_shop")},
+		}
+	}
+	for _, testCase := range []struct {
+		name     string
+		modify   func(secretData *corev1.Secret)
+		expected bool
+	}{
+		{name: "secret of a previous operator version", modify: func(*corev1.Secret) {}, expected: true},
+		{name: "secret owned by the resource", modify: func(secretData *corev1.Secret) {
+			secretData.OwnerReferences = []metav1.OwnerReference{ownerReference(resource)}
+		}, expected: true},
+		{name: "secret owned by another resource", modify: func(secretData *corev1.Secret) {
+			secretData.OwnerReferences = []metav1.OwnerReference{{Kind: resourcesv1.DatabaseKind, Name: "other", UID: "other"}}
+		}, expected: false},
+		{name: "secret without the operator label", modify: func(secretData *corev1.Secret) {
+			secretData.Labels = nil
+		}, expected: false},
+		{name: "secret of another operator instance", modify: func(secretData *corev1.Secret) {
+			secretData.Labels[instanceLabel] = "mysql-default"
+		}, expected: false},
+		{name: "secret for other names", modify: func(secretData *corev1.Secret) {
+			secretData.Data["database"] = []byte("billing")
+		}, expected: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			secretData := legacySecret()
+			testCase.modify(secretData)
+			assert.Equal(t, testCase.expected, m.isLegacySecret(resource, secretData, names))
+		})
+	}
+}
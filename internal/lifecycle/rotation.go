@@ -0,0 +1,226 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	"external-db-operator/internal/password"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// passwordRotationInterval returns the configured rotation interval of the resource, zero if rotation is disabled.
+func passwordRotationInterval(databaseResourceData *resourcesv1.Database) (time.Duration, error) {
+	if databaseResourceData.Spec.PasswordRotation == nil || databaseResourceData.Spec.PasswordRotation.Interval == "" {
+		return 0, nil
+	}
+	interval, parseError := time.ParseDuration(databaseResourceData.Spec.PasswordRotation.Interval)
+	if parseError != nil {
+		return 0, helper.Permanent(fmt.Errorf("invalid password rotation interval: %w", parseError))
+	}
+	if interval <= 0 {
+		return 0, helper.Permanent(fmt.Errorf("invalid password rotation interval: %s must be positive", interval))
+	}
+	return interval, nil
+}
+
+// defaultRotationGracePeriod is the duration the previous login of a dual user rotation keeps its password by default.
+const defaultRotationGracePeriod = time.Hour
+
+// passwordRotationMode returns the rotation mode of the resource and, for dual user rotation, its grace period.
+func passwordRotationMode(databaseResourceData *resourcesv1.Database) (string, time.Duration, error) {
+	if databaseResourceData.Spec.PasswordRotation == nil {
+		return resourcesv1.PasswordRotationModeInPlace, 0, nil
+	}
+
+	switch databaseResourceData.Spec.PasswordRotation.Mode {
+	case "", resourcesv1.PasswordRotationModeInPlace:
+		return resourcesv1.PasswordRotationModeInPlace, 0, nil
+	case resourcesv1.PasswordRotationModeDualUser:
+	default:
+		return "", 0, helper.Permanent(fmt.Errorf("unknown password rotation mode: %s", databaseResourceData.Spec.PasswordRotation.Mode))
+	}
+
+	if databaseResourceData.Spec.PasswordRotation.GracePeriod == "" {
+		return resourcesv1.PasswordRotationModeDualUser, defaultRotationGracePeriod, nil
+	}
+	gracePeriod, parseError := time.ParseDuration(databaseResourceData.Spec.PasswordRotation.GracePeriod)
+	if parseError != nil {
+		return "", 0, helper.Permanent(fmt.Errorf("invalid password rotation grace period: %w", parseError))
+	}
+	if gracePeriod < 0 {
+		return "", 0, helper.Permanent(fmt.Errorf("invalid password rotation grace period: %s must not be negative", gracePeriod))
+	}
+	return resourcesv1.PasswordRotationModeDualUser, gracePeriod, nil
+}
+
+// dualUserLogins returns the two logins alternating in the secret, derived from the name of the owner.
+func dualUserLogins(owner string, maxLength int) []string {
+	base := database.ShortenName(owner, maxLength-len("_a"))
+	return []string{base + "_a", base + "_b"}
+}
+
+// resolveLogins returns the logins of a dual user rotation, which are not pinned in the status yet, nil if there are
+// none. The logins are ensured to be claimed by no one else.
+func (m *Manager) resolveLogins(ctx context.Context, databaseResourceData *resourcesv1.Database, provider database.Provider, names resourceNames) ([]string, error) {
+	mode, _, modeError := passwordRotationMode(databaseResourceData)
+	if modeError != nil || mode != resourcesv1.PasswordRotationModeDualUser {
+		return nil, modeError
+	}
+	logins := dualUserLogins(names.User, provider.NamingRules().MaxUserNameLength)
+	if slices.Equal(logins, databaseResourceData.Status.Logins) {
+		return nil, nil
+	}
+	if collisionError := m.checkNewNames(ctx, databaseResourceData, provider, claimedNames{users: logins}); collisionError != nil {
+		return nil, collisionError
+	}
+	return logins, nil
+}
+
+// credentialPlan describes the user written to the secret and the passwords set on the database server.
+type credentialPlan struct {
+	Username      string
+	OwnerPassword string
+	Logins        []database.Login
+}
+
+// planCredentials decides which user the secret points to. Without dual user rotation, this is always the owner.
+// With dual user rotation, every rotation switches the secret to the other login, while the previous one keeps its
+// password for the grace period. Resources provisioned before enabling dual user rotation switch away from the owner.
+func (m *Manager) planCredentials(databaseResourceData *resourcesv1.Database, provider database.Provider, names resourceNames, policy password.Policy, currentPassword string, secretExists, rotate bool, now time.Time, outcome *eventOutcome) (credentialPlan, error) {
+	mode, gracePeriod, modeError := passwordRotationMode(databaseResourceData)
+	if modeError != nil {
+		return credentialPlan{}, modeError
+	}
+	status := databaseResourceData.Status
+	outcome.Logins = status.Logins
+
+	if mode == resourcesv1.PasswordRotationModeInPlace {
+		plan := credentialPlan{Username: names.User, OwnerPassword: currentPassword}
+		if status.ActiveUsername != "" {
+			// the logins of a former dual user rotation must not keep a known password
+			for _, login := range status.Logins {
+				resetPassword, generateError := password.Generate(policy)
+				if generateError != nil {
+					return credentialPlan{}, generateError
+				}
+				plan.Logins = append(plan.Logins, database.Login{Username: login, Password: resetPassword})
+			}
+		}
+		return plan, nil
+	}
+
+	// the logins have been checked and pinned in the status by markUsers before
+	logins := dualUserLogins(names.User, provider.NamingRules().MaxUserNameLength)
+	active, retired := status.ActiveUsername, status.RetiredUsername
+	var resetAt time.Time
+	if status.RetiredPasswordResetAt != nil {
+		resetAt = status.RetiredPasswordResetAt.Time
+	}
+	if active == "" {
+		active = logins[0]
+		if secretExists {
+			active = names.User
+		}
+	}
+
+	passwords := map[string]string{}
+	resetPassword, generateError := password.Generate(policy)
+	if generateError != nil {
+		return credentialPlan{}, generateError
+	}
+	switch {
+	case rotate && secretExists:
+		if retired != "" {
+			// a rotation within the grace period retires the previous login right away
+			passwords[retired] = resetPassword
+		}
+		next := logins[0]
+		if active == logins[0] {
+			next = logins[1]
+		}
+		active, retired, resetAt = next, active, now.Add(gracePeriod)
+	case retired != "" && !now.Before(resetAt):
+		passwords[retired] = resetPassword
+		retired, resetAt = "", time.Time{}
+	}
+	passwords[active] = currentPassword
+
+	plan := credentialPlan{Username: active, OwnerPassword: passwords[names.User]}
+	for _, login := range logins {
+		plan.Logins = append(plan.Logins, database.Login{Username: login, Password: passwords[login]})
+	}
+	outcome.Logins = logins
+	outcome.ActiveUsername = active
+	outcome.RetiredUsername = retired
+	outcome.RetiredPasswordResetAt = resetAt
+	return plan, nil
+}
+
+// lastPasswordRotation returns the time the current password has been set. Secrets written by operator versions
+// without rotation support still hold their initial password.
+func lastPasswordRotation(databaseResourceData *resourcesv1.Database, existingSecret *corev1.Secret) time.Time {
+	if databaseResourceData.Status.LastPasswordRotation != nil {
+		return databaseResourceData.Status.LastPasswordRotation.Time
+	}
+	return existingSecret.CreationTimestamp.Time
+}
+
+// passwordRotationDue reports whether the password of an existing secret has to be rotated, either because it has been
+// requested by annotation or because the rotation interval has passed.
+func passwordRotationDue(databaseResourceData *resourcesv1.Database, existingSecret *corev1.Secret, now time.Time) (bool, error) {
+	if _, requested := databaseResourceData.Annotations[resourcesv1.RotatePasswordAnnotation]; requested {
+		return true, nil
+	}
+	interval, intervalError := passwordRotationInterval(databaseResourceData)
+	if intervalError != nil || interval == 0 {
+		return false, intervalError
+	}
+	return !now.Before(lastPasswordRotation(databaseResourceData, existingSecret).Add(interval)), nil
+}
+
+// schedulePasswordRotation requeues the resource once its password is due for rotation, or the password of the
+// retired login has to be reset.
+func (m *Manager) schedulePasswordRotation(key string, databaseResourceData *resourcesv1.Database, outcome eventOutcome) {
+	if !outcome.RetiredPasswordResetAt.IsZero() {
+		m.queue.AddAfter(key, time.Until(outcome.RetiredPasswordResetAt))
+	}
+	interval, intervalError := passwordRotationInterval(databaseResourceData)
+	if intervalError != nil || interval == 0 || outcome.LastPasswordRotation.IsZero() {
+		return
+	}
+	m.queue.AddAfter(key, time.Until(outcome.LastPasswordRotation.Add(interval)))
+}
+
+// clearPasswordRotationRequest removes the rotation request annotation, once the password has been rotated.
+func (m *Manager) clearPasswordRotationRequest(ctx context.Context, object *unstructured.Unstructured) error {
+	if _, requested := object.GetAnnotations()[resourcesv1.RotatePasswordAnnotation]; !requested {
+		return nil
+	}
+
+	slog.Info("clearing password rotation request", slog.String("name", object.GetName()), slog.String("namespace", object.GetNamespace()))
+	patch, marshalError := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]any{resourcesv1.RotatePasswordAnnotation: nil},
+		},
+	})
+	if marshalError != nil {
+		return helper.Permanent(marshalError)
+	}
+
+	_, patchError := m.clients.KubernetesDynamic.Resource(resourcesv1.DatabaseResource).Namespace(object.GetNamespace()).Patch(ctx, object.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if patchError != nil {
+		return fmt.Errorf("failed to clear password rotation request: %w", classifyKubernetesError(patchError))
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/password"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// namingProvider only provides the naming rules, which is all the pure planning functions need.
+type namingProvider struct {
+	database.Provider
+}
+
+func (namingProvider) NamingRules() database.NamingRules {
+	return database.NamingRules{MaxDatabaseNameLength: 63, MaxUserNameLength: 63}
+}
+
+func TestPasswordRotationDue(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	secretCreated := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour))}}
+	for _, testCase := range []struct {
+		name        string
+		resource    resourcesv1.Database
+		expected    bool
+		expectError bool
+	}{
+		{name: "rotation disabled", resource: resourcesv1.Database{}, expected: false},
+		{
+			name:     "requested by annotation",
+			resource: resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{resourcesv1.RotatePasswordAnnotation: ""}}},
+			expected: true,
+		},
+		{
+			name: "interval passed since last rotation",
+			resource: resourcesv1.Database{
+				Spec:   resourcesv1.DatabaseSpec{PasswordRotation: &resourcesv1.PasswordRotation{Interval: "1h"}},
+				Status: resourcesv1.DatabaseStatus{LastPasswordRotation: statusTime(now.Add(-time.Hour))},
+			},
+			expected: true,
+		},
+		{
+			name: "interval not yet passed",
+			resource: resourcesv1.Database{
+				Spec:   resourcesv1.DatabaseSpec{PasswordRotation: &resourcesv1.PasswordRotation{Interval: "1h"}},
+				Status: resourcesv1.DatabaseStatus{LastPasswordRotation: statusTime(now.Add(-30 * time.Minute))},
+			},
+			expected: false,
+		},
+		{
+			name:     "legacy secret without rotation status",
+			resource: resourcesv1.Database{Spec: resourcesv1.DatabaseSpec{PasswordRotation: &resourcesv1.PasswordRotation{Interval: "24h"}}},
+			expected: true,
+		},
+		{
+			name:        "invalid interval",
+			resource:    resourcesv1.Database{Spec: resourcesv1.DatabaseSpec{PasswordRotation: &resourcesv1.PasswordRotation{Interval: "-1h"}}},
+			expectError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			due, dueError := passwordRotationDue(&testCase.resource, secretCreated, now)
+			if testCase.expectError {
+				assert.Error(t, dueError)
+				return
+			}
+			assert.NoError(t, dueError)
+			assert.Equal(t, testCase.expected, due)
+		})
+	}
+}
+
+func TestPlanCredentials(t *testing.T) {
+	const (
+		owner   = "app"
+		loginA  = "app_a"
+		loginB  = "app_b"
+		current = "current-password"
+		// reset marks a login password, which has to be generated freshly.
+		reset = "<reset>"
+	)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	dualUser := &resourcesv1.PasswordRotation{Mode: resourcesv1.PasswordRotationModeDualUser, GracePeriod: "1h"}
+
+	for _, testCase := range []struct {
+		name             string
+		rotation         *resourcesv1.PasswordRotation
+		status           resourcesv1.DatabaseStatus
+		secretExists     bool
+		rotate           bool
+		expectedUsername string
+		expectedOwner    string
+		expectedLogins   map[string]string
+		expectedActive   string
+		expectedRetired  string
+		expectedResetAt  time.Time
+	}{
+		{
+			name:             "in place",
+			secretExists:     true,
+			rotate:           true,
+			expectedUsername: owner,
+			expectedOwner:    current,
+		},
+		{
+			name:             "in place after dual user rotation resets the logins",
+			status:           resourcesv1.DatabaseStatus{Logins: []string{loginA, loginB}, ActiveUsername: loginB},
+			secretExists:     true,
+			expectedUsername: owner,
+			expectedOwner:    current,
+			expectedLogins:   map[string]string{loginA: reset, loginB: reset},
+		},
+		{
+			name:             "new resource starts with the first login",
+			rotation:         dualUser,
+			expectedUsername: loginA,
+			expectedLogins:   map[string]string{loginA: current, loginB: ""},
+			expectedActive:   loginA,
+		},
+		{
+			name:             "existing resource keeps the owner until the first rotation",
+			rotation:         dualUser,
+			secretExists:     true,
+			expectedUsername: owner,
+			expectedOwner:    current,
+			expectedLogins:   map[string]string{loginA: "", loginB: ""},
+			expectedActive:   owner,
+		},
+		{
+			name:             "first rotation switches from the owner to the first login",
+			rotation:         dualUser,
+			status:           resourcesv1.DatabaseStatus{Logins: []string{loginA, loginB}},
+			secretExists:     true,
+			rotate:           true,
+			expectedUsername: loginA,
+			expectedLogins:   map[string]string{loginA: current, loginB: ""},
+			expectedActive:   loginA,
+			expectedRetired:  owner,
+			expectedResetAt:  now.Add(time.Hour),
+		},
+		{
+			name:             "rotation switches to the second login",
+			rotation:         dualUser,
+			status:           resourcesv1.DatabaseStatus{Logins: []string{loginA, loginB}, ActiveUsername: loginA},
+			secretExists:     true,
+			rotate:           true,
+			expectedUsername: loginB,
+			expectedLogins:   map[string]string{loginA: "", loginB: current},
+			expectedActive:   loginB,
+			expectedRetired:  loginA,
+			expectedResetAt:  now.Add(time.Hour),
+		},
+		{
+			name:             "rotation switches back to the first login",
+			rotation:         dualUser,
+			status:           resourcesv1.DatabaseStatus{Logins: []string{loginA, loginB}, ActiveUsername: loginB},
+			secretExists:     true,
+			rotate:           true,
+			expectedUsername: loginA,
+			expectedLogins:   map[string]string{loginA: current, loginB: ""},
+			expectedActive:   loginA,
+			expectedRetired:  loginB,
+			expectedResetAt:  now.Add(time.Hour),
+		},
+		{
+			name:     "rotation within the grace period retires the previous login right away",
+			rotation: dualUser,
+			status: resourcesv1.DatabaseStatus{
+				Logins: []string{loginA, loginB}, ActiveUsername: loginB, RetiredUsername: loginA,
+				RetiredPasswordResetAt: statusTime(now.Add(30 * time.Minute)),
+			},
+			secretExists:     true,
+			rotate:           true,
+			expectedUsername: loginA,
+			expectedLogins:   map[string]string{loginA: current, loginB: ""},
+			expectedActive:   loginA,
+			expectedRetired:  loginB,
+			expectedResetAt:  now.Add(time.Hour),
+		},
+		{
+			name:     "retired login keeps its password within the grace period",
+			rotation: dualUser,
+			status: resourcesv1.DatabaseStatus{
+				Logins: []string{loginA, loginB}, ActiveUsername: loginB, RetiredUsername: loginA,
+				RetiredPasswordResetAt: statusTime(now.Add(30 * time.Minute)),
+			},
+			secretExists:     true,
+			expectedUsername: loginB,
+			expectedLogins:   map[string]string{loginA: "", loginB: current},
+			expectedActive:   loginB,
+			expectedRetired:  loginA,
+			expectedResetAt:  now.Add(30 * time.Minute),
+		},
+		{
+			name:     "retired login is reset once the grace period passed",
+			rotation: dualUser,
+			status: resourcesv1.DatabaseStatus{
+				Logins: []string{loginA, loginB}, ActiveUsername: loginB, RetiredUsername: loginA,
+				RetiredPasswordResetAt: statusTime(now.Add(-time.Minute)),
+			},
+			secretExists:     true,
+			expectedUsername: loginB,
+			expectedLogins:   map[string]string{loginA: reset, loginB: current},
+			expectedActive:   loginB,
+		},
+		{
+			name:     "retired owner is reset once the grace period passed",
+			rotation: dualUser,
+			status: resourcesv1.DatabaseStatus{
+				Logins: []string{loginA, loginB}, ActiveUsername: loginA, RetiredUsername: owner,
+				RetiredPasswordResetAt: statusTime(now.Add(-time.Minute)),
+			},
+			secretExists:     true,
+			expectedUsername: loginA,
+			expectedOwner:    reset,
+			expectedLogins:   map[string]string{loginA: current, loginB: ""},
+			expectedActive:   loginA,
+		},
+		{
+			name:             "interrupted first reconciliation starts with the pinned first login again",
+			rotation:         dualUser,
+			status:           resourcesv1.DatabaseStatus{Logins: []string{loginA, loginB}},
+			expectedUsername: loginA,
+			expectedLogins:   map[string]string{loginA: current, loginB: ""},
+			expectedActive:   loginA,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			databaseResourceData := &resourcesv1.Database{
+				Spec:   resourcesv1.DatabaseSpec{PasswordRotation: testCase.rotation},
+				Status: testCase.status,
+			}
+
+			// a rotation interrupted before its outcome has been recorded is planned again from the same status
+			var outcomes [2]eventOutcome
+			var plans [2]credentialPlan
+			for attempt := range plans {
+				var planError error
+				plans[attempt], planError = (&Manager{}).planCredentials(databaseResourceData, namingProvider{}, resourceNames{Database: owner, User: owner}, password.DefaultPolicy, current, testCase.secretExists, testCase.rotate, now, &outcomes[attempt])
+				require.NoError(t, planError)
+			}
+			plan, outcome := plans[0], outcomes[0]
+			assert.Equal(t, plan.Username, plans[1].Username)
+			assert.Equal(t, outcome.ActiveUsername, outcomes[1].ActiveUsername)
+			assert.Equal(t, outcome.RetiredUsername, outcomes[1].RetiredUsername)
+
+			assert.Equal(t, testCase.expectedUsername, plan.Username)
+			assertPassword(t, testCase.expectedOwner, plan.OwnerPassword, current)
+			logins := map[string]string{}
+			for _, login := range plan.Logins {
+				logins[login.Username] = login.Password
+			}
+			assert.Len(t, logins, len(testCase.expectedLogins))
+			for username, expected := range testCase.expectedLogins {
+				assertPassword(t, expected, logins[username], current)
+			}
+			assert.Equal(t, testCase.expectedActive, outcome.ActiveUsername)
+			assert.Equal(t, testCase.expectedRetired, outcome.RetiredUsername)
+			assert.Equal(t, testCase.expectedResetAt, outcome.RetiredPasswordResetAt)
+		})
+	}
+}
+
+// assertPassword compares the password with the expected one, where <reset> stands for any freshly generated password.
+func assertPassword(t *testing.T, expected, actual, current string) {
+	t.Helper()
+	if expected == "<reset>" {
+		assert.NotEmpty(t, actual)
+		assert.NotEqual(t, current, actual)
+		return
+	}
+	assert.Equal(t, expected, actual)
+}
@@ -0,0 +1,52 @@
+package lifecycle
+
+import (
+	"fmt"
+	"slices"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// resourceSchemas resolves the owners of the schemas of the spec, which are either the owner of the database or one
+// of the additional users. Logins of a dual user rotation share the search path of the owner. All users are listed,
+// so search paths no longer requested get reset.
+func resourceSchemas(databaseResourceData *resourcesv1.Database, names resourceNames, logins []string, users []resourcesv1.DatabaseUserStatus) (database.SchemaOptions, error) {
+	options := database.SchemaOptions{
+		Name:        names.Database,
+		SearchPaths: map[string][]string{},
+		Usernames:   slices.Concat([]string{names.User}, logins, additionalUsernames(users)),
+	}
+	specPostgres := databaseResourceData.Spec.Postgres
+	if specPostgres == nil {
+		return options, nil
+	}
+
+	options.RevokePublicCreate = specPostgres.RevokePublicCreate
+	for _, schema := range specPostgres.Schemas {
+		if schema.Name == "" {
+			return database.SchemaOptions{}, helper.Permanent(fmt.Errorf("schema name must not be empty"))
+		}
+		if slices.ContainsFunc(options.Schemas, func(other database.Schema) bool { return other.Name == schema.Name }) {
+			return database.SchemaOptions{}, helper.Permanent(fmt.Errorf("schema %s is listed more than once", schema.Name))
+		}
+
+		owners := append([]string{names.User}, logins...)
+		if schema.Owner != "" {
+			index := slices.IndexFunc(users, func(user resourcesv1.DatabaseUserStatus) bool { return user.Name == schema.Owner })
+			if index < 0 {
+				return database.SchemaOptions{}, helper.Permanent(fmt.Errorf("owner %s of schema %s is no user of the database", schema.Owner, schema.Name))
+			}
+			owners = []string{users[index].Username}
+		}
+
+		options.Schemas = append(options.Schemas, database.Schema{Name: schema.Name, Owner: owners[0]})
+		if schema.SearchPath {
+			for _, owner := range owners {
+				options.SearchPaths[owner] = append(options.SearchPaths[owner], schema.Name)
+			}
+		}
+	}
+	return options, nil
+}
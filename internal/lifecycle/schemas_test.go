@@ -0,0 +1,70 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"external-db-operator/internal/database"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+func TestResourceSchemas(t *testing.T) {
+	names := resourceNames{Database: "app", User: "app"}
+	users := []resourcesv1.DatabaseUserStatus{{Name: "reporting", Username: "app_reporting", Profile: "readonly"}}
+	for _, testCase := range []struct {
+		name        string
+		postgres    *resourcesv1.PostgresSpec
+		logins      []string
+		expected    database.SchemaOptions
+		expectError bool
+	}{
+		{
+			name:     "no postgres spec resets all search paths",
+			postgres: nil,
+			expected: database.SchemaOptions{Name: "app", SearchPaths: map[string][]string{}, Usernames: []string{"app", "app_reporting"}},
+		},
+		{
+			name: "schemas of the owner and an additional user",
+			postgres: &resourcesv1.PostgresSpec{
+				Schemas: []resourcesv1.PostgresSchema{
+					{Name: "core", SearchPath: true},
+					{Name: "reports", Owner: "reporting", SearchPath: true},
+					{Name: "archive"},
+				},
+				RevokePublicCreate: true,
+			},
+			expected: database.SchemaOptions{
+				Name:               "app",
+				Schemas:            []database.Schema{{Name: "core", Owner: "app"}, {Name: "reports", Owner: "app_reporting"}, {Name: "archive", Owner: "app"}},
+				RevokePublicCreate: true,
+				SearchPaths:        map[string][]string{"app": {"core"}, "app_reporting": {"reports"}},
+				Usernames:          []string{"app", "app_reporting"},
+			},
+		},
+		{
+			name:     "logins share the search path of the owner",
+			postgres: &resourcesv1.PostgresSpec{Schemas: []resourcesv1.PostgresSchema{{Name: "core", SearchPath: true}, {Name: "audit", SearchPath: true}}},
+			logins:   []string{"app_a", "app_b"},
+			expected: database.SchemaOptions{
+				Name:        "app",
+				Schemas:     []database.Schema{{Name: "core", Owner: "app"}, {Name: "audit", Owner: "app"}},
+				SearchPaths: map[string][]string{"app": {"core", "audit"}, "app_a": {"core", "audit"}, "app_b": {"core", "audit"}},
+				Usernames:   []string{"app", "app_a", "app_b", "app_reporting"},
+			},
+		},
+		{name: "empty name", postgres: &resourcesv1.PostgresSpec{Schemas: []resourcesv1.PostgresSchema{{Name: ""}}}, expectError: true},
+		{name: "duplicate schema", postgres: &resourcesv1.PostgresSpec{Schemas: []resourcesv1.PostgresSchema{{Name: "core"}, {Name: "core"}}}, expectError: true},
+		{name: "unknown owner", postgres: &resourcesv1.PostgresSpec{Schemas: []resourcesv1.PostgresSchema{{Name: "core", Owner: "worker"}}}, expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			options, schemasError := resourceSchemas(&resourcesv1.Database{Spec: resourcesv1.DatabaseSpec{Postgres: testCase.postgres}}, names, testCase.logins, users)
+			if testCase.expectError {
+				assert.Error(t, schemasError)
+				return
+			}
+			assert.NoError(t, schemasError)
+			assert.Equal(t, testCase.expected, options)
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package lifecycle
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// serverProvider is the provider connected to a DatabaseServer. The dsn is formatted whenever the server or its
+// credentials secret changes, which is watched by an informer of its own. The provider is reinitialized with the dsn on
+// the next call, replaced only if the server switches to another kind of provider.
+type serverProvider struct {
+	provider   *database.ReloadingProvider
+	generation int64
+	spec       resourcesv1.DatabaseServerSpec
+	pool       database.PoolSettings
+
+	credentials     cache.SharedInformer
+	stopCredentials chan struct{}
+
+	dsn      string
+	dsnError error
+}
+
+// ErrServerNotFound is returned if a resource refers to a DatabaseServer, which does not exist.
+type ErrServerNotFound struct {
+	Name string
+}
+
+func (e ErrServerNotFound) Error() string {
+	return fmt.Sprintf("database server %s not found", e.Name)
+}
+
+// ErrNoDefaultServer is returned for resources without a DatabaseServer, if the operator has no default server.
+var ErrNoDefaultServer = errors.New("no default database server configured, the resource has to refer to a DatabaseServer")
+
+// serverName returns the name of the DatabaseServer the resource is provisioned on, empty for the default server of
+// the operator. Once provisioned, the server is pinned in the status along with the names.
+func serverName(databaseResourceData *resourcesv1.Database) string {
+	if databaseResourceData.Status.DatabaseName != "" {
+		return databaseResourceData.Status.ServerName
+	}
+	if databaseResourceData.Spec.ServerRef != nil {
+		return databaseResourceData.Spec.ServerRef.Name
+	}
+	return ""
+}
+
+// handles reports whether the resource is provisioned by this operator instance. That is either the case if it carries
+// the label of the instance, or if it carries no instance label and refers to a DatabaseServer assigned to the instance.
+func (m *Manager) handles(databaseResourceData *resourcesv1.Database) bool {
+	if m.selector.Matches(labels.Set(databaseResourceData.Labels)) {
+		return true
+	}
+	name := serverName(databaseResourceData)
+	if name == "" || m.hasInstanceLabel(databaseResourceData.Labels) {
+		return false
+	}
+	server, getServerError := m.server(name)
+	return getServerError == nil && cmp.Or(server.Spec.Instance, resourcesv1.DefaultInstance) == m.settings.InstanceName
+}
+
+// hasInstanceLabel reports whether the labels select any operator instance, not necessarily this one.
+func (m *Manager) hasInstanceLabel(labelSet map[string]string) bool {
+	if m.selector == nil {
+		return false
+	}
+	requirements, _ := m.selector.Requirements()
+	for _, requirement := range requirements {
+		if _, found := labelSet[requirement.Key()]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// server returns the DatabaseServer from the informer cache.
+func (m *Manager) server(name string) (*resourcesv1.DatabaseServer, error) {
+	cachedObject, getServerError := m.serverLister.Get(name)
+	if apierrors.IsNotFound(getServerError) {
+		return nil, ErrServerNotFound{Name: name}
+	}
+	if getServerError != nil {
+		return nil, getServerError
+	}
+	server, convertError := resourcesv1.DatabaseServerFromUnstructured(cachedObject.(*unstructured.Unstructured).Object)
+	if convertError != nil {
+		return nil, helper.Permanent(fmt.Errorf("failed to convert unstructured object: %w", convertError))
+	}
+	return server, nil
+}
+
+// provider returns the provider of the database server the resource is provisioned on.
+func (m *Manager) provider(ctx context.Context, databaseResourceData *resourcesv1.Database) (database.Provider, error) {
+	if name := serverName(databaseResourceData); name != "" {
+		return m.serverProvider(ctx, name)
+	}
+	if m.clients.Database == nil {
+		return nil, helper.Permanent(ErrNoDefaultServer)
+	}
+	return m.clients.Database, nil
+}
+
+// serverProvider returns the provider connected to the DatabaseServer, reconnecting it if the server or its
+// credentials changed. Broken connections are replaced by the connection pool of the provider on its own. The lock
+// only guards the lookup, so connecting to a slow server does not hold up the reconciliation of other resources.
+func (m *Manager) serverProvider(ctx context.Context, name string) (database.Provider, error) {
+	server, getServerError := m.server(name)
+	if getServerError != nil {
+		return nil, getServerError
+	}
+
+	m.serversMutex.Lock()
+	current, updateError := m.updateServer(server)
+	var dsn string
+	if updateError == nil {
+		switch {
+		case !current.credentials.HasSynced():
+			updateError = fmt.Errorf("credentials of database server %s not loaded yet", name)
+		case current.dsnError != nil:
+			updateError = current.dsnError
+		}
+		dsn = current.dsn
+	}
+	m.serversMutex.Unlock()
+	if updateError != nil {
+		return nil, updateError
+	}
+
+	// unchanged dsns keep the connection, otherwise the previous one is closed once its pending calls returned
+	initializeContext, cancelInitialize := m.databaseContext(ctx)
+	defer cancelInitialize()
+	if initializationError := current.provider.Initialize(initializeContext, dsn); initializationError != nil {
+		return nil, fmt.Errorf("failed to connect to database server %s: %w", name, initializationError)
+	}
+
+	// a provider evicted meanwhile has been closed already and must not keep the new connection
+	m.serversMutex.Lock()
+	latest, exists := m.servers[name]
+	evicted := !exists || latest.provider != current.provider
+	m.serversMutex.Unlock()
+	if evicted {
+		closeProvider(name, current.provider)
+		return nil, fmt.Errorf("database server %s changed while connecting", name)
+	}
+
+	return current.provider, nil
+}
+
+// updateServer applies a changed DatabaseServer to its provider, which is replaced if the server switches to another
+// kind of provider or connection pool. The credentials secret is watched again if the server refers to another one. The caller has to
+// hold the servers lock.
+func (m *Manager) updateServer(server *resourcesv1.DatabaseServer) (*serverProvider, error) {
+	name := server.Name
+	current, exists := m.servers[name]
+	if exists && current.generation == server.Generation {
+		return current, nil
+	}
+
+	pool, poolError := m.serverPool(server)
+	if poolError != nil {
+		return nil, poolError
+	}
+	updated := &serverProvider{generation: server.Generation, spec: server.Spec, pool: pool}
+	if exists && current.spec.Provider == server.Spec.Provider && current.pool == pool {
+		updated.provider = current.provider
+	} else {
+		provider, newProviderError := database.NewReloadingProvider(server.Spec.Provider, pool)
+		if newProviderError != nil {
+			return nil, helper.Permanent(newProviderError)
+		}
+		updated.provider = provider
+		if exists {
+			// closing waits for a connection attempt in progress, which must not hold up the servers lock
+			go closeProvider(name, current.provider)
+		}
+	}
+	if exists && current.spec.CredentialsSecretRef.Namespace == server.Spec.CredentialsSecretRef.Namespace && current.spec.CredentialsSecretRef.Name == server.Spec.CredentialsSecretRef.Name {
+		updated.credentials, updated.stopCredentials = current.credentials, current.stopCredentials
+	} else {
+		if exists {
+			close(current.stopCredentials)
+		}
+		updated.credentials, updated.stopCredentials = m.watchCredentials(name, server.Spec.CredentialsSecretRef)
+	}
+	updated.dsn, updated.dsnError = m.serverDSN(name, updated)
+
+	m.servers[name] = updated
+	return updated, nil
+}
+
+// serverPool returns the connection pool settings of the DatabaseServer, falling back to the ones of the operator.
+func (m *Manager) serverPool(server *resourcesv1.DatabaseServer) (database.PoolSettings, error) {
+	pool := m.settings.Pool
+	if server.Spec.Pool == nil {
+		return pool, nil
+	}
+
+	if server.Spec.Pool.MaxConnections != 0 {
+		pool.MaxConnections = server.Spec.Pool.MaxConnections
+	}
+	for _, duration := range []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{name: "connectionLifetime", value: server.Spec.Pool.ConnectionLifetime, target: &pool.ConnectionLifetime},
+		{name: "healthCheckInterval", value: server.Spec.Pool.HealthCheckInterval, target: &pool.HealthCheckInterval},
+	} {
+		if duration.value == "" {
+			continue
+		}
+		parsed, parseError := time.ParseDuration(duration.value)
+		if parseError != nil {
+			return database.PoolSettings{}, helper.Permanent(fmt.Errorf("invalid %s of database server %s: %s", duration.name, server.Name, duration.value))
+		}
+		*duration.target = parsed
+	}
+	if validateError := pool.Validate(); validateError != nil {
+		return database.PoolSettings{}, helper.Permanent(fmt.Errorf("invalid pool of database server %s: %w", server.Name, validateError))
+	}
+	return pool, nil
+}
+
+// watchCredentials starts an informer watching the credentials secret of the DatabaseServer only. Changes of the
+// secret format the dsn again and reconcile the resources provisioned on the server, which reconnects to it.
+func (m *Manager) watchCredentials(name string, secretRef resourcesv1.SecretReference) (cache.SharedInformer, chan struct{}) {
+	listWatch := cache.NewFilteredListWatchFromClient(m.clients.Kubernetes.CoreV1().RESTClient(), "secrets", secretRef.Namespace, func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", secretRef.Name).String()
+	})
+	informer := cache.NewSharedInformer(listWatch, &corev1.Secret{}, m.settings.ResyncPeriod)
+	_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(any) {
+			m.handleCredentialsChange(name, informer)
+		},
+		UpdateFunc: func(any, any) {
+			m.handleCredentialsChange(name, informer)
+		},
+		DeleteFunc: func(any) {
+			m.handleCredentialsChange(name, informer)
+		},
+	})
+
+	stop := make(chan struct{})
+	go informer.Run(stop)
+	return informer, stop
+}
+
+// handleCredentialsChange formats the dsn of the DatabaseServer again, reconciling its resources if it changed.
+func (m *Manager) handleCredentialsChange(name string, informer cache.SharedInformer) {
+	m.serversMutex.Lock()
+	current, exists := m.servers[name]
+	if !exists || current.credentials != informer {
+		// the server has been deleted or refers to another secret meanwhile
+		m.serversMutex.Unlock()
+		return
+	}
+	dsn, dsnError := m.serverDSN(name, current)
+	changed := dsn != current.dsn || (dsnError == nil) != (current.dsnError == nil)
+	current.dsn, current.dsnError = dsn, dsnError
+	m.serversMutex.Unlock()
+
+	if changed {
+		m.enqueueServerResources(name)
+	}
+}
+
+// serverDSN formats the dsn of the DatabaseServer from its spec and the cached credentials secret.
+func (m *Manager) serverDSN(name string, server *serverProvider) (string, error) {
+	secretRef := server.spec.CredentialsSecretRef
+	cachedObject, found, getSecretError := server.credentials.GetStore().GetByKey(secretRef.Namespace + "/" + secretRef.Name)
+	if getSecretError != nil {
+		return "", fmt.Errorf("failed to get credentials of database server %s: %w", name, getSecretError)
+	}
+	if !found {
+		return "", fmt.Errorf("credentials secret %s/%s of database server %s not found", secretRef.Namespace, secretRef.Name, name)
+	}
+	credentialsSecret := cachedObject.(*corev1.Secret)
+
+	credentials := database.Credentials{Host: server.spec.Host, Port: server.spec.Port, Database: server.spec.Database}
+	for _, key := range []struct {
+		name   string
+		target *string
+	}{
+		{name: cmp.Or(secretRef.UsernameKey, "username"), target: &credentials.Username},
+		{name: cmp.Or(secretRef.PasswordKey, "password"), target: &credentials.Password},
+	} {
+		value, found := credentialsSecret.Data[key.name]
+		if !found {
+			return "", helper.Permanent(fmt.Errorf("credentials secret %s/%s of database server %s lacks key %s", secretRef.Namespace, secretRef.Name, name, key.name))
+		}
+		*key.target = string(value)
+	}
+
+	// the dsn is formatted by a provider of the requested kind, which does not need to be connected for that
+	formatter, provideError := database.Provide(server.spec.Provider, database.PoolSettings{})
+	if provideError != nil {
+		return "", helper.Permanent(provideError)
+	}
+	return formatter.FormatDSN(credentials, server.spec.Parameters), nil
+}
+
+// closeProvider closes the connection to the DatabaseServer once all pending calls returned, without waiting for them.
+func closeProvider(name string, provider database.Provider) {
+	slog.Info("closing connection to database server", slog.String("name", name))
+	if closeError := provider.Close(); closeError != nil {
+		slog.Error("failed to close connection to database server", slog.String("name", name), slog.String("error", closeError.Error()))
+	}
+}
+
+// closeServerProviders closes the connections to all DatabaseServers and stops watching their credentials.
+func (m *Manager) closeServerProviders() {
+	m.serversMutex.Lock()
+	defer m.serversMutex.Unlock()
+
+	for name, current := range m.servers {
+		close(current.stopCredentials)
+		closeProvider(name, current.provider)
+		delete(m.servers, name)
+	}
+}
+
+// handleServerChange applies a changed DatabaseServer and reconciles the resources provisioned on it, which reconnects
+// to it. Changes of the metadata are ignored.
+func (m *Manager) handleServerChange(oldObj, newObj any) {
+	if oldObj != nil && oldObj.(*unstructured.Unstructured).GetGeneration() == newObj.(*unstructured.Unstructured).GetGeneration() {
+		return
+	}
+	server, convertError := resourcesv1.DatabaseServerFromUnstructured(newObj.(*unstructured.Unstructured).Object)
+	if convertError != nil {
+		slog.Error("failed to convert unstructured object", slog.String("error", convertError.Error()))
+		return
+	}
+
+	m.serversMutex.Lock()
+	_, updateError := m.updateServer(server)
+	m.serversMutex.Unlock()
+	if updateError != nil {
+		slog.Error("failed to update database server", slog.String("name", server.Name), slog.String("error", updateError.Error()))
+	}
+	m.enqueueServerResources(server.Name)
+}
+
+// enqueueServerResources enqueues all resources provisioned on the DatabaseServer by this operator instance.
+func (m *Manager) enqueueServerResources(name string) {
+	objects, listError := m.lister.List(labels.Everything())
+	if listError != nil {
+		slog.Error("failed to list database resources", slog.String("error", listError.Error()))
+		return
+	}
+	for _, object := range objects {
+		databaseResourceData, convertError := resourcesv1.FromUnstructured(object.(*unstructured.Unstructured).Object)
+		if convertError == nil && serverName(databaseResourceData) == name && m.handles(databaseResourceData) {
+			m.enqueue(object)
+		}
+	}
+}
+
+// handleServerDeletion closes the connection to a deleted DatabaseServer.
+func (m *Manager) handleServerDeletion(obj any) {
+	name, keyError := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if keyError != nil {
+		slog.Error("failed to build object key", slog.String("error", keyError.Error()))
+		return
+	}
+	m.serversMutex.Lock()
+	current, exists := m.servers[name]
+	delete(m.servers, name)
+	m.serversMutex.Unlock()
+
+	if exists {
+		// pending calls of running reconciliations complete before the connection is closed
+		close(current.stopCredentials)
+		closeProvider(name, current.provider)
+	}
+}
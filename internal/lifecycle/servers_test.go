@@ -0,0 +1,158 @@
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+func TestHandles(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, server := range []*resourcesv1.DatabaseServer{
+		{ObjectMeta: metav1.ObjectMeta{Name: "shared"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "reporting"}, Spec: resourcesv1.DatabaseServerSpec{Instance: "reporting"}},
+	} {
+		object, convertError := runtime.DefaultUnstructuredConverter.ToUnstructured(server)
+		require.NoError(t, convertError)
+		require.NoError(t, indexer.Add(&unstructured.Unstructured{Object: object}))
+	}
+	m := &Manager{
+		settings:     Settings{InstanceName: "default"},
+		selector:     labels.SelectorFromSet(labels.Set{instanceLabel: "postgres-default"}),
+		serverLister: cache.NewGenericLister(indexer, resourcesv1.DatabaseServerResource.GroupResource()),
+	}
+
+	for _, testCase := range []struct {
+		name      string
+		labels    map[string]string
+		serverRef string
+		expected  bool
+	}{
+		{name: "instance label", labels: map[string]string{instanceLabel: "postgres-default"}, expected: true},
+		{name: "label of another instance", labels: map[string]string{instanceLabel: "mysql-default"}, serverRef: "shared", expected: false},
+		{name: "unlabeled without server", expected: false},
+		{name: "unlabeled on a server of the instance", serverRef: "shared", expected: true},
+		{name: "unlabeled on a server of another instance", serverRef: "reporting", expected: false},
+		{name: "unlabeled on an unknown server", serverRef: "missing", expected: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			resource := &resourcesv1.Database{ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "team-a", Labels: testCase.labels}}
+			if testCase.serverRef != "" {
+				resource.Spec.ServerRef = &resourcesv1.ServerReference{Name: testCase.serverRef}
+			}
+			assert.Equal(t, testCase.expected, m.handles(resource))
+		})
+	}
+}
+
+// dsnProvider formats the dsn from the credentials only.
+type dsnProvider struct {
+	database.Provider
+}
+
+func (dsnProvider) FormatDSN(credentials database.Credentials, _ map[string]string) string {
+	return credentials.Username + ":" + credentials.Password + "@" + credentials.Host
+}
+
+func TestServerDSN(t *testing.T) {
+	database.RegisterProvider("dsn", func(database.PoolSettings) database.Provider { return dsnProvider{} })
+
+	m := &Manager{}
+	for _, testCase := range []struct {
+		name        string
+		secretRef   resourcesv1.SecretReference
+		data        map[string][]byte
+		expected    string
+		expectError bool
+		permanent   bool
+	}{
+		{
+			name:      "default keys",
+			secretRef: resourcesv1.SecretReference{Name: "credentials", Namespace: "operator"},
+			data:      map[string][]byte{"username": []byte("admin"), "password": []byte("secret")},
+			expected:  "admin:secret@db.example.com",
+		},
+		{
+			name:      "custom keys",
+			secretRef: resourcesv1.SecretReference{Name: "credentials", Namespace: "operator", UsernameKey: "user", PasswordKey: "pass"},
+			data:      map[string][]byte{"user": []byte("root"), "pass": []byte("hidden")},
+			expected:  "root:hidden@db.example.com",
+		},
+		{
+			name:        "missing key",
+			secretRef:   resourcesv1.SecretReference{Name: "credentials", Namespace: "operator"},
+			data:        map[string][]byte{"username": []byte("admin")},
+			expectError: true,
+			permanent:   true,
+		},
+		{
+			name:        "missing secret",
+			secretRef:   resourcesv1.SecretReference{Name: "other", Namespace: "operator"},
+			expectError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			credentials := cache.NewSharedInformer(&cache.ListWatch{}, &corev1.Secret{}, 0)
+			require.NoError(t, credentials.GetStore().Add(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "operator"},
+				Data:       testCase.data,
+			}))
+			server := &serverProvider{
+				spec:        resourcesv1.DatabaseServerSpec{Provider: "dsn", Host: "db.example.com", CredentialsSecretRef: testCase.secretRef},
+				credentials: credentials,
+			}
+
+			dsn, dsnError := m.serverDSN("main", server)
+			if testCase.expectError {
+				require.Error(t, dsnError)
+				assert.Equal(t, testCase.permanent, helper.IsPermanentError(dsnError))
+				return
+			}
+			require.NoError(t, dsnError)
+			assert.Equal(t, testCase.expected, dsn)
+		})
+	}
+}
+
+func TestServerPool(t *testing.T) {
+	m := &Manager{settings: Settings{Pool: database.PoolSettings{MaxConnections: 10, ConnectionLifetime: time.Hour}}}
+	for _, testCase := range []struct {
+		name        string
+		pool        *resourcesv1.ConnectionPool
+		expected    database.PoolSettings
+		expectError bool
+	}{
+		{name: "operator defaults", expected: database.PoolSettings{MaxConnections: 10, ConnectionLifetime: time.Hour}},
+		{
+			name:     "server settings",
+			pool:     &resourcesv1.ConnectionPool{MaxConnections: 3, HealthCheckInterval: "30s"},
+			expected: database.PoolSettings{MaxConnections: 3, ConnectionLifetime: time.Hour, HealthCheckInterval: 30 * time.Second},
+		},
+		{name: "invalid duration", pool: &resourcesv1.ConnectionPool{ConnectionLifetime: "forever"}, expectError: true},
+		{name: "negative duration", pool: &resourcesv1.ConnectionPool{HealthCheckInterval: "-1m"}, expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := &resourcesv1.DatabaseServer{ObjectMeta: metav1.ObjectMeta{Name: "main"}, Spec: resourcesv1.DatabaseServerSpec{Pool: testCase.pool}}
+			pool, poolError := m.serverPool(server)
+			if testCase.expectError {
+				require.Error(t, poolError)
+				assert.True(t, helper.IsPermanentError(poolError))
+				return
+			}
+			require.NoError(t, poolError)
+			assert.Equal(t, testCase.expected, pool)
+		})
+	}
+}
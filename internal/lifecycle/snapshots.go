@@ -0,0 +1,124 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// ErrSnapshotsDisabled is returned if a resource is snapshotted on deletion, but no snapshot directory is configured.
+var ErrSnapshotsDisabled = errors.New("snapshots are disabled, as no snapshot directory is configured")
+
+// snapshotPath returns the path of the snapshot file pinned in the status of the resource.
+func (m *Manager) snapshotPath(databaseResourceData *resourcesv1.Database) string {
+	return filepath.Join(m.settings.SnapshotDirectory, databaseResourceData.Namespace, databaseResourceData.Status.SnapshotName)
+}
+
+// takeSnapshot writes a logical dump of the database to the snapshot file pinned in the status. The dump is written to
+// a temporary file first, so an existing snapshot file is complete and not taken again on retry. A database which does
+// not exist anymore has been dropped by a previous attempt after its snapshot had been taken.
+func (m *Manager) takeSnapshot(ctx context.Context, databaseResourceData *resourcesv1.Database, names resourceNames, provider database.Provider, reporter database.Reporter) error {
+	if m.settings.SnapshotDirectory == "" {
+		return helper.Permanent(ErrSnapshotsDisabled)
+	}
+	snapshotPath := m.snapshotPath(databaseResourceData)
+	if _, statError := os.Stat(snapshotPath); statError == nil {
+		return nil
+	}
+
+	existsContext, cancelExists := m.databaseContext(ctx)
+	databaseExists, existsError := provider.DatabaseExists(existsContext, names.Database)
+	cancelExists()
+	if existsError != nil {
+		return fmt.Errorf("failed to look up database %s: %w", names.Database, existsError)
+	}
+	if !databaseExists {
+		return nil
+	}
+
+	if mkdirError := os.MkdirAll(filepath.Dir(snapshotPath), 0o700); mkdirError != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", mkdirError)
+	}
+	snapshotFile, createError := os.CreateTemp(filepath.Dir(snapshotPath), "."+filepath.Base(snapshotPath)+"-*")
+	if createError != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", createError)
+	}
+	defer os.Remove(snapshotFile.Name())
+
+	slog.Info("snapshotting database", slog.String("name", names.Database), slog.String("path", snapshotPath))
+	reporter("SnapshottingDatabase", "snapshotting database "+names.Database+" to "+snapshotPath)
+	dumpContext, cancelDump := m.databaseContext(ctx)
+	dumpError := provider.Dump(dumpContext, names.Database, snapshotFile)
+	cancelDump()
+	if dumpError == nil {
+		dumpError = snapshotFile.Sync()
+	}
+	if closeError := snapshotFile.Close(); dumpError == nil {
+		dumpError = closeError
+	}
+	if dumpError != nil {
+		return fmt.Errorf("failed to snapshot database %s: %w", names.Database, dumpError)
+	}
+	if renameError := os.Rename(snapshotFile.Name(), snapshotPath); renameError != nil {
+		return fmt.Errorf("failed to snapshot database %s: %w", names.Database, renameError)
+	}
+	return nil
+}
+
+// finalAttempt reports whether the failed handling of the resource is going to be given up instead of retried.
+func (m *Manager) finalAttempt(object runtime.Object, handlingError error) bool {
+	if helper.IsPermanentError(handlingError) {
+		return true
+	}
+	key, keyError := cache.MetaNamespaceKeyFunc(object)
+	return keyError == nil && m.queue.NumRequeues(key) >= m.settings.MaxRetries
+}
+
+// pruneSnapshots removes the snapshot files which are older than the configured retention. Temporary files of
+// interrupted snapshots are removed along with them.
+func (m *Manager) pruneSnapshots(now time.Time) {
+	walkError := filepath.WalkDir(m.settings.SnapshotDirectory, func(path string, entry fs.DirEntry, walkError error) error {
+		if walkError != nil || entry.IsDir() || !strings.HasSuffix(path, ".sql") && !strings.HasPrefix(entry.Name(), ".") {
+			return walkError
+		}
+		info, infoError := entry.Info()
+		if infoError != nil || now.Sub(info.ModTime()) < m.settings.SnapshotRetention {
+			return nil
+		}
+		slog.Info("removing expired snapshot", slog.String("path", path))
+		return os.Remove(path)
+	})
+	if walkError != nil && !errors.Is(walkError, fs.ErrNotExist) {
+		slog.Error("failed to prune snapshots", slog.String("error", walkError.Error()))
+	}
+}
+
+// runSnapshotPruning prunes the expired snapshots in every resync period, until the context is cancelled.
+func (m *Manager) runSnapshotPruning(ctx context.Context) {
+	if m.settings.SnapshotDirectory == "" || m.settings.SnapshotRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(max(m.settings.ResyncPeriod, time.Minute))
+	defer ticker.Stop()
+	for {
+		m.pruneSnapshots(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
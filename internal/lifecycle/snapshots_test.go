@@ -0,0 +1,111 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// dumpProvider dumps the given content, or fails with the given error.
+type dumpProvider struct {
+	database.Provider
+	missing bool
+	dumpErr error
+	dumps   int
+}
+
+func (p *dumpProvider) DatabaseExists(context.Context, string) (bool, error) {
+	return !p.missing, nil
+}
+
+func (p *dumpProvider) Dump(_ context.Context, name string, w io.Writer) error {
+	p.dumps++
+	if _, writeError := io.WriteString(w, "-- dump of "+name+"\n"); writeError != nil {
+		return writeError
+	}
+	return p.dumpErr
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	resource := &resourcesv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "shop", Namespace: "team-a"},
+		Status:     resourcesv1.DatabaseStatus{SnapshotName: "team_a_shop_20240601120000.sql"},
+	}
+	names := resourceNames{Database: "team_a_shop", User: "team_a_shop"}
+	reporter := func(string, string) {}
+
+	t.Run("snapshot is taken once", func(t *testing.T) {
+		m := &Manager{settings: Settings{SnapshotDirectory: t.TempDir()}}
+		provider := &dumpProvider{}
+		require.NoError(t, m.takeSnapshot(context.Background(), resource, names, provider, reporter))
+		require.NoError(t, m.takeSnapshot(context.Background(), resource, names, provider, reporter))
+		assert.Equal(t, 1, provider.dumps)
+
+		content, readError := os.ReadFile(filepath.Join(m.settings.SnapshotDirectory, "team-a", "team_a_shop_20240601120000.sql"))
+		require.NoError(t, readError)
+		assert.Equal(t, "-- dump of team_a_shop\n", string(content))
+	})
+
+	t.Run("failed dump leaves no snapshot", func(t *testing.T) {
+		m := &Manager{settings: Settings{SnapshotDirectory: t.TempDir()}}
+		provider := &dumpProvider{dumpErr: errors.New("connection reset")}
+		assert.Error(t, m.takeSnapshot(context.Background(), resource, names, provider, reporter))
+
+		entries, readError := os.ReadDir(filepath.Join(m.settings.SnapshotDirectory, "team-a"))
+		require.NoError(t, readError)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("dropped database is not snapshotted again", func(t *testing.T) {
+		m := &Manager{settings: Settings{SnapshotDirectory: t.TempDir()}}
+		provider := &dumpProvider{missing: true}
+		assert.NoError(t, m.takeSnapshot(context.Background(), resource, names, provider, reporter))
+		assert.Zero(t, provider.dumps)
+	})
+
+	t.Run("snapshots disabled", func(t *testing.T) {
+		snapshotError := (&Manager{}).takeSnapshot(context.Background(), resource, names, &dumpProvider{}, reporter)
+		assert.ErrorIs(t, snapshotError, ErrSnapshotsDisabled)
+		assert.True(t, helper.IsPermanentError(snapshotError))
+	})
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	m := &Manager{settings: Settings{SnapshotDirectory: t.TempDir(), SnapshotRetention: 24 * time.Hour}}
+	for name, age := range map[string]time.Duration{
+		"team-a/expired.sql":            48 * time.Hour,
+		"team-a/recent.sql":             time.Hour,
+		"team-b/.interrupted.sql-12345": 48 * time.Hour,
+		"team-b/unrelated.txt":          48 * time.Hour,
+	} {
+		path := filepath.Join(m.settings.SnapshotDirectory, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+
+	m.pruneSnapshots(now)
+
+	for name, kept := range map[string]bool{
+		"team-a/expired.sql":            false,
+		"team-a/recent.sql":             true,
+		"team-b/.interrupted.sql-12345": false,
+		"team-b/unrelated.txt":          true,
+	} {
+		_, statError := os.Stat(filepath.Join(m.settings.SnapshotDirectory, name))
+		assert.Equal(t, kept, statError == nil, name)
+	}
+}
@@ -0,0 +1,194 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	"external-db-operator/internal/password"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// updateStatus applies the mutation to the status of the given resource and writes it back, if anything changed.
+func (m *Manager) updateStatus(ctx context.Context, object *unstructured.Unstructured, mutate func(databaseResourceData *resourcesv1.Database, status *resourcesv1.DatabaseStatus)) (*unstructured.Unstructured, error) {
+	databaseResourceData, convertError := resourcesv1.FromUnstructured(object.Object)
+	if convertError != nil {
+		return nil, helper.Permanent(fmt.Errorf("failed to convert unstructured object: %w", convertError))
+	}
+
+	status := databaseResourceData.Status
+	status.Conditions = slices.Clone(databaseResourceData.Status.Conditions)
+	mutate(databaseResourceData, &status)
+	if equality.Semantic.DeepEqual(databaseResourceData.Status, status) {
+		return object, nil
+	}
+
+	statusObject, statusConvertError := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if statusConvertError != nil {
+		return nil, helper.Permanent(fmt.Errorf("failed to convert status: %w", statusConvertError))
+	}
+	object = object.DeepCopy()
+	object.Object["status"] = statusObject
+
+	updatedObject, updateError := m.clients.KubernetesDynamic.Resource(resourcesv1.DatabaseResource).Namespace(object.GetNamespace()).UpdateStatus(ctx, object, metav1.UpdateOptions{})
+	if updateError != nil {
+		return nil, fmt.Errorf("failed to update status: %w", classifyKubernetesError(updateError))
+	}
+
+	return updatedObject, nil
+}
+
+// markProvisioning flags the resource as being provisioned, if its current generation has not been reconciled yet.
+// The resolved names are stored as well, unless already present, along with the database server they belong to.
+func (m *Manager) markProvisioning(ctx context.Context, object *unstructured.Unstructured, names resourceNames) (*unstructured.Unstructured, error) {
+	return m.updateStatus(ctx, object, func(databaseResourceData *resourcesv1.Database, status *resourcesv1.DatabaseStatus) {
+		if status.DatabaseName == "" || status.Username == "" {
+			status.ServerName = serverName(databaseResourceData)
+			status.DatabaseName = names.Database
+			status.Username = names.User
+		}
+		if status.ObservedGeneration == object.GetGeneration() {
+			return
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               resourcesv1.ConditionProvisioning,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Provisioning",
+			Message:            "database is being provisioned",
+			ObservedGeneration: object.GetGeneration(),
+		})
+	})
+}
+
+// markUsers pins the names of new additional users and dual user logins in the status, before they get created on the
+// database server. Later reconciliations then recognize them as names of the resource itself.
+func (m *Manager) markUsers(ctx context.Context, object *unstructured.Unstructured, provider database.Provider, names resourceNames) (*unstructured.Unstructured, error) {
+	databaseResourceData, convertError := resourcesv1.FromUnstructured(object.Object)
+	if convertError != nil {
+		return nil, helper.Permanent(fmt.Errorf("failed to convert unstructured object: %w", convertError))
+	}
+
+	m.claimsMutex.Lock()
+	defer m.claimsMutex.Unlock()
+
+	users, resolveUsersError := m.resolveUsers(ctx, databaseResourceData, provider, names)
+	if resolveUsersError != nil {
+		return nil, resolveUsersError
+	}
+	logins, resolveLoginsError := m.resolveLogins(ctx, databaseResourceData, provider, names)
+	if resolveLoginsError != nil {
+		return nil, resolveLoginsError
+	}
+
+	updatedObject, updateError := m.updateStatus(ctx, object, func(_ *resourcesv1.Database, status *resourcesv1.DatabaseStatus) {
+		for _, user := range users {
+			if !slices.ContainsFunc(status.Users, func(provisioned resourcesv1.DatabaseUserStatus) bool { return provisioned.Name == user.Name }) {
+				status.Users = append(status.Users, user)
+			}
+		}
+		if logins != nil {
+			status.Logins = logins
+		}
+	})
+	if updateError != nil {
+		return nil, updateError
+	}
+	if updatedObject != object {
+		m.rememberClaims(updatedObject)
+	}
+	return updatedObject, nil
+}
+
+// markSnapshot pins the name of the snapshot file before it gets written, if the resource is snapshotted on deletion.
+// Retries then complete the same snapshot instead of taking another one.
+func (m *Manager) markSnapshot(ctx context.Context, object *unstructured.Unstructured, names resourceNames) (*unstructured.Unstructured, error) {
+	return m.updateStatus(ctx, object, func(databaseResourceData *resourcesv1.Database, status *resourcesv1.DatabaseStatus) {
+		deletionPolicy, deletionPolicyError := m.deletionPolicy(databaseResourceData)
+		if deletionPolicyError != nil || deletionPolicy != database.DeletionPolicySnapshot || status.SnapshotName != "" {
+			return
+		}
+		status.SnapshotName = database.SnapshotName(names.Database, time.Now())
+	})
+}
+
+// recordResult reflects the outcome of a reconciliation in the status of the resource.
+func (m *Manager) recordResult(ctx context.Context, object *unstructured.Unstructured, outcome eventOutcome, reconcileError error) error {
+	_, updateError := m.updateStatus(ctx, object, func(databaseResourceData *resourcesv1.Database, status *resourcesv1.DatabaseStatus) {
+		generation := object.GetGeneration()
+		status.ObservedGeneration = generation
+		status.SecretName = m.secretName(databaseResourceData)
+		if deletionPolicy, deletionPolicyError := m.deletionPolicy(databaseResourceData); deletionPolicyError == nil {
+			status.DeletionPolicy = string(deletionPolicy)
+		}
+
+		if !outcome.LastPasswordRotation.IsZero() {
+			status.LastPasswordRotation = statusTime(outcome.LastPasswordRotation)
+		}
+		if reconcileError == nil {
+			status.Users = outcome.Users
+			status.Extensions = outcome.Extensions
+			status.Logins = outcome.Logins
+			status.ActiveUsername = outcome.ActiveUsername
+			status.RetiredUsername = outcome.RetiredUsername
+			status.RetiredPasswordResetAt = nil
+			if !outcome.RetiredPasswordResetAt.IsZero() {
+				status.RetiredPasswordResetAt = statusTime(outcome.RetiredPasswordResetAt)
+			}
+		}
+
+		if reconcileError != nil {
+			reason := failureReason(reconcileError)
+			status.LastError = reconcileError.Error()
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: resourcesv1.ConditionReady, Status: metav1.ConditionFalse, Reason: reason, Message: reconcileError.Error(), ObservedGeneration: generation})
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: resourcesv1.ConditionProvisioning, Status: metav1.ConditionFalse, Reason: reason, ObservedGeneration: generation})
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: resourcesv1.ConditionFailed, Status: metav1.ConditionTrue, Reason: reason, Message: reconcileError.Error(), ObservedGeneration: generation})
+			return
+		}
+
+		status.LastError = ""
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: resourcesv1.ConditionReady, Status: metav1.ConditionTrue, Reason: "Reconciled", Message: "database is ready to use", ObservedGeneration: generation})
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: resourcesv1.ConditionProvisioning, Status: metav1.ConditionFalse, Reason: "Reconciled", ObservedGeneration: generation})
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: resourcesv1.ConditionFailed, Status: metav1.ConditionFalse, Reason: "Reconciled", ObservedGeneration: generation})
+	})
+	return updateError
+}
+
+// statusTime converts the time to the precision kept by the api server, so unchanged times compare equal.
+func statusTime(t time.Time) *metav1.Time {
+	statusTime := metav1.NewTime(t.Truncate(time.Second))
+	return &statusTime
+}
+
+// failureReason derives the machine-readable condition reason from the reconcile error.
+func failureReason(reconcileError error) string {
+	switch {
+	case errors.As(reconcileError, &database.ErrImmutableProperty{}):
+		return "ImmutablePropertyChanged"
+	case errors.As(reconcileError, &database.ErrUnsupportedOption{}):
+		return "UnsupportedOption"
+	case errors.As(reconcileError, &database.ErrInvalidName{}):
+		return "InvalidName"
+	case errors.As(reconcileError, &ErrNameCollision{}):
+		return "NameCollision"
+	case errors.As(reconcileError, &ErrServerNotFound{}):
+		return "ServerNotFound"
+	case errors.As(reconcileError, &database.ErrUnknownProvider{}):
+		return "UnknownProvider"
+	case errors.As(reconcileError, &password.ErrInvalidPolicy{}):
+		return "InvalidPasswordPolicy"
+	case errors.Is(reconcileError, ErrNameOverrideDisabled):
+		return "NameOverrideDisabled"
+	default:
+		return "ReconcileFailed"
+	}
+}
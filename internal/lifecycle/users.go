@@ -0,0 +1,188 @@
+package lifecycle
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"external-db-operator/internal/database"
+	"external-db-operator/internal/helper"
+	"external-db-operator/internal/naming"
+	"external-db-operator/internal/password"
+	resourcesv1 "external-db-operator/internal/resources/v1"
+)
+
+// additionalUserNamePattern keeps the name usable within secret names as well as user names.
+var additionalUserNamePattern = regexp.MustCompile("^[a-z0-9]([a-z0-9-]*[a-z0-9])?$")
+
+func additionalUsernames(users []resourcesv1.DatabaseUserStatus) []string {
+	usernames := make([]string, 0, len(users))
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	return usernames
+}
+
+// resolveUsers determines the names of the additional users requested in the spec. Once provisioned, the user names
+// are pinned in the status.
+func (m *Manager) resolveUsers(ctx context.Context, databaseResourceData *resourcesv1.Database, provider database.Provider, names resourceNames) ([]resourcesv1.DatabaseUserStatus, error) {
+	namingRules := provider.NamingRules()
+
+	var users []resourcesv1.DatabaseUserStatus
+	var newNames claimedNames
+	for _, user := range databaseResourceData.Spec.Users {
+		if !additionalUserNamePattern.MatchString(user.Name) {
+			return nil, helper.Permanent(fmt.Errorf("invalid user name %q: only lowercase letters, digits and dashes are allowed", user.Name))
+		}
+		if !slices.Contains(database.ListUserProfiles(), user.Profile) {
+			return nil, helper.Permanent(fmt.Errorf("unknown profile %q of user %s", user.Profile, user.Name))
+		}
+		if slices.ContainsFunc(users, func(other resourcesv1.DatabaseUserStatus) bool { return other.Name == user.Name }) {
+			return nil, helper.Permanent(fmt.Errorf("user %s is listed more than once", user.Name))
+		}
+
+		resolved := resourcesv1.DatabaseUserStatus{
+			Name:       user.Name,
+			SecretName: m.userSecretName(databaseResourceData, user.Name),
+			Profile:    user.Profile,
+		}
+		if index := slices.IndexFunc(databaseResourceData.Status.Users, func(provisioned resourcesv1.DatabaseUserStatus) bool { return provisioned.Name == user.Name }); index >= 0 {
+			resolved.Username = databaseResourceData.Status.Users[index].Username
+			resolved.SecretName = cmp.Or(databaseResourceData.Status.Users[index].SecretName, resolved.SecretName)
+		} else {
+			resolved.Username = database.ShortenName(names.User+"_"+naming.Sanitize(user.Name), namingRules.MaxUserNameLength)
+			if validationError := namingRules.ValidateUserName(resolved.Username); validationError != nil {
+				return nil, helper.Permanent(validationError)
+			}
+			newNames.users = append(newNames.users, resolved.Username)
+			newNames.secrets = append(newNames.secrets, resolved.SecretName)
+		}
+		users = append(users, resolved)
+	}
+
+	if len(newNames.users) > 0 {
+		if collisionError := m.checkNewNames(ctx, databaseResourceData, provider, newNames); collisionError != nil {
+			return nil, collisionError
+		}
+	}
+	return users, nil
+}
+
+// reconcileUsers provisions the additional users with their secrets, and removes the ones no longer requested.
+// The passwords are rotated along with the password of the owner.
+func (m *Manager) reconcileUsers(ctx context.Context, databaseResourceData *resourcesv1.Database, provider database.Provider, names resourceNames, connectionInfo database.ConnectionInfo, policy password.Policy, limits database.Limits, rotatePassword bool, secretMeta metav1.ObjectMeta, reporter database.Reporter) ([]resourcesv1.DatabaseUserStatus, error) {
+	users, resolveError := m.resolveUsers(ctx, databaseResourceData, provider, names)
+	if resolveError != nil {
+		return nil, resolveError
+	}
+
+	for _, user := range users {
+		existingSecret, getSecretError := m.clients.Kubernetes.CoreV1().Secrets(databaseResourceData.Namespace).Get(ctx, user.SecretName, metav1.GetOptions{})
+		if getSecretError != nil && !errors.IsNotFound(getSecretError) {
+			return nil, fmt.Errorf("failed to get secret: %w", classifyKubernetesError(getSecretError))
+		}
+		if getSecretError == nil {
+			if ownerError := verifySecretOwner(databaseResourceData, existingSecret); ownerError != nil {
+				return nil, ownerError
+			}
+		}
+
+		userPassword := ""
+		if getSecretError == nil && !rotatePassword {
+			userPassword = string(existingSecret.Data["password"])
+		}
+		if userPassword == "" {
+			var generateError error
+			if userPassword, generateError = password.Generate(policy); generateError != nil {
+				return nil, generateError
+			}
+		}
+
+		var previousProfile string
+		if index := slices.IndexFunc(databaseResourceData.Status.Users, func(provisioned resourcesv1.DatabaseUserStatus) bool { return provisioned.Name == user.Name }); index >= 0 {
+			previousProfile = databaseResourceData.Status.Users[index].Profile
+		}
+		applyContext, cancelApply := m.databaseContext(ctx)
+		applyUserError := provider.ApplyUser(applyContext, database.UserOptions{
+			Name:            names.Database,
+			Owner:           names.User,
+			Username:        user.Username,
+			Password:        userPassword,
+			Profile:         database.UserProfile(user.Profile),
+			Privileges:      databaseResourceData.Spec.Privileges,
+			AllowedHosts:    m.allowedHosts(databaseResourceData),
+			Limits:          limits,
+			PreviousProfile: database.UserProfile(previousProfile),
+			Reporter:        reporter,
+		})
+		cancelApply()
+		if applyUserError != nil {
+			return nil, fmt.Errorf("failed to apply user %s: %w", user.Name, applyUserError)
+		}
+
+		credentials := database.Credentials{
+			Host:     connectionInfo.Host,
+			Port:     connectionInfo.Port,
+			Database: names.Database,
+			Username: user.Username,
+			Password: userPassword,
+		}
+		secretData := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            user.SecretName,
+				Annotations:     secretMeta.Annotations,
+				Labels:          secretMeta.Labels,
+				OwnerReferences: secretMeta.OwnerReferences,
+			},
+			StringData: map[string]string{
+				"username": credentials.Username,
+				"password": credentials.Password,
+				"host":     credentials.Host,
+				"port":     fmt.Sprintf("%d", credentials.Port),
+				"database": credentials.Database,
+			},
+		}
+		renderedKeys, renderError := m.renderSecretTemplate(databaseResourceData, provider, credentials)
+		if renderError != nil {
+			return nil, renderError
+		}
+		maps.Copy(secretData.StringData, renderedKeys)
+
+		if getSecretError != nil {
+			existingSecret = nil
+		}
+		if secretError := m.writeSecret(ctx, databaseResourceData.Namespace, secretData, existingSecret, reporter); secretError != nil {
+			return nil, secretError
+		}
+	}
+
+	for _, provisioned := range databaseResourceData.Status.Users {
+		if slices.ContainsFunc(users, func(user resourcesv1.DatabaseUserStatus) bool { return user.Name == provisioned.Name }) {
+			continue
+		}
+		destroyContext, cancelDestroy := m.databaseContext(ctx)
+		destroyUserError := provider.DestroyUser(destroyContext, database.UserOptions{
+			Name:     names.Database,
+			Owner:    names.User,
+			Username: provisioned.Username,
+			Profile:  database.UserProfile(provisioned.Profile),
+			Reporter: reporter,
+		})
+		cancelDestroy()
+		if destroyUserError != nil {
+			return nil, fmt.Errorf("failed to destroy user %s: %w", provisioned.Name, destroyUserError)
+		}
+		if secretDeleteError := m.deleteSecret(ctx, databaseResourceData, provisioned.SecretName, true, reporter); secretDeleteError != nil {
+			return nil, secretDeleteError
+		}
+	}
+
+	return users, nil
+}
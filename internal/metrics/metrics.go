@@ -10,4 +10,12 @@ var (
 		Namespace: "external_db_operator",
 		Name:      "event_processing_duration_seconds",
 	}, []string{"event_type"})
+	ReconcileErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "external_db_operator",
+		Name:      "reconcile_errors_total",
+	}, []string{"classification"})
+	ReconcileRetriesExhausted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "external_db_operator",
+		Name:      "reconcile_retries_exhausted_total",
+	})
 )
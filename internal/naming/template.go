@@ -0,0 +1,61 @@
+package naming
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	DefaultDatabaseNameTemplate = "{{ .Namespace }}_{{ .Name }}"
+	DefaultUserNameTemplate     = "{{ .Namespace }}_{{ .Name }}"
+)
+
+// Data is passed to the naming templates. Namespace and name are sanitized, so they are valid within identifiers.
+type Data struct {
+	Namespace string
+	Name      string
+	// DatabaseName is the rendered database name, only available to user name templates.
+	DatabaseName string
+}
+
+func NewData(namespace, name string) Data {
+	return Data{
+		Namespace: Sanitize(namespace),
+		Name:      Sanitize(name),
+	}
+}
+
+var illegalCharacters = regexp.MustCompile("[.-]+")
+
+// Sanitize replaces characters allowed in kubernetes object names, but not in database identifiers.
+func Sanitize(input string) string {
+	return illegalCharacters.ReplaceAllString(input, "_")
+}
+
+var templateFunctions = template.FuncMap{
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"sanitize": Sanitize,
+}
+
+type Template struct {
+	template *template.Template
+}
+
+func Parse(text string) (*Template, error) {
+	parsedTemplate, parseError := template.New("name").Funcs(templateFunctions).Option("missingkey=error").Parse(text)
+	if parseError != nil {
+		return nil, fmt.Errorf("failed to parse naming template %q: %w", text, parseError)
+	}
+	return &Template{template: parsedTemplate}, nil
+}
+
+func (t *Template) Render(data Data) (string, error) {
+	var builder strings.Builder
+	if executeError := t.template.Execute(&builder, data); executeError != nil {
+		return "", fmt.Errorf("failed to render naming template: %w", executeError)
+	}
+	return strings.TrimSpace(builder.String()), nil
+}
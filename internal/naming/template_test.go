@@ -0,0 +1,55 @@
+package naming
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		template string
+		data     Data
+		expected string
+	}{
+		{
+			name:     "default",
+			template: DefaultDatabaseNameTemplate,
+			data:     NewData("my-namespace", "demo.app"),
+			expected: "my_namespace_demo_app",
+		},
+		{
+			name:     "prefixed",
+			template: "k8s_prod_{{ .Namespace }}_{{ .Name }}",
+			data:     NewData("foo", "bar"),
+			expected: "k8s_prod_foo_bar",
+		},
+		{
+			name:     "user derived from database",
+			template: "{{ .DatabaseName }}_app",
+			data:     Data{DatabaseName: "foo_bar"},
+			expected: "foo_bar_app",
+		},
+		{
+			name:     "functions",
+			template: "{{ .Name | upper }}",
+			data:     NewData("foo", "bar"),
+			expected: "BAR",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			parsedTemplate, parseError := Parse(testCase.template)
+			assert.NoError(t, parseError)
+
+			actual, renderError := parsedTemplate.Render(testCase.data)
+			assert.NoError(t, renderError)
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, parseError := Parse("{{ .Name ")
+	assert.Error(t, parseError)
+}
@@ -0,0 +1,196 @@
+package password
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	lowercaseCharacters = "abcdefghijklmnopqrstuvwxyz"
+	uppercaseCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitCharacters     = "0123456789"
+	// specialCharacters leaves out quotes, backslashes and whitespace, which are often mishandled by clients.
+	specialCharacters = "!#$%&*+-.:=?@^_~"
+
+	maxLength = 256
+)
+
+// Policy describes the shape of generated passwords. Every character class with a minimum greater than zero is used,
+// and contained at least that many times.
+type Policy struct {
+	Length    int
+	Lowercase int
+	Uppercase int
+	Digits    int
+	Special   int
+}
+
+// DefaultPolicy generates passwords of 32 letters and digits.
+var DefaultPolicy = Policy{Length: 32, Lowercase: 1, Uppercase: 1, Digits: 1}
+
+// ErrInvalidPolicy is returned for policies which cannot generate passwords, or which violate the rules of the server.
+type ErrInvalidPolicy struct {
+	Reason string
+}
+
+func (e ErrInvalidPolicy) Error() string {
+	return "invalid password policy: " + e.Reason
+}
+
+// ParsePolicy parses a policy in the form length=32,lowercase=1,uppercase=1,digits=1,special=0.
+// Omitted fields are taken from the default policy.
+func ParsePolicy(text string) (Policy, error) {
+	policy := DefaultPolicy
+	fields := map[string]*int{
+		"length":    &policy.Length,
+		"lowercase": &policy.Lowercase,
+		"uppercase": &policy.Uppercase,
+		"digits":    &policy.Digits,
+		"special":   &policy.Special,
+	}
+	for _, pair := range strings.Split(text, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		field, known := fields[strings.TrimSpace(key)]
+		if !found || !known {
+			return Policy{}, ErrInvalidPolicy{Reason: fmt.Sprintf("unknown setting %q", pair)}
+		}
+		number, parseError := strconv.Atoi(strings.TrimSpace(value))
+		if parseError != nil {
+			return Policy{}, ErrInvalidPolicy{Reason: fmt.Sprintf("setting %q is not a number", pair)}
+		}
+		*field = number
+	}
+	return policy, policy.Validate()
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("length=%d,lowercase=%d,uppercase=%d,digits=%d,special=%d", p.Length, p.Lowercase, p.Uppercase, p.Digits, p.Special)
+}
+
+func (p Policy) classes() []struct {
+	characters string
+	minimum    int
+} {
+	return []struct {
+		characters string
+		minimum    int
+	}{
+		{characters: lowercaseCharacters, minimum: p.Lowercase},
+		{characters: uppercaseCharacters, minimum: p.Uppercase},
+		{characters: digitCharacters, minimum: p.Digits},
+		{characters: specialCharacters, minimum: p.Special},
+	}
+}
+
+// Validate ensures the policy is able to generate passwords.
+func (p Policy) Validate() error {
+	if p.Lowercase < 0 || p.Uppercase < 0 || p.Digits < 0 || p.Special < 0 {
+		return ErrInvalidPolicy{Reason: "character class minimums must not be negative"}
+	}
+	if p.Lowercase+p.Uppercase+p.Digits+p.Special == 0 {
+		return ErrInvalidPolicy{Reason: "at least one character class is required"}
+	}
+	if p.Length < p.Lowercase+p.Uppercase+p.Digits+p.Special {
+		return ErrInvalidPolicy{Reason: fmt.Sprintf("length %d is shorter than the character class minimums", p.Length)}
+	}
+	if p.Length > maxLength {
+		return ErrInvalidPolicy{Reason: fmt.Sprintf("length must not exceed %d", maxLength)}
+	}
+	return nil
+}
+
+// Requirements are the rules a database server enforces on passwords.
+type Requirements struct {
+	MinLength    int
+	MinLowercase int
+	MinUppercase int
+	MinDigits    int
+	MinSpecial   int
+}
+
+// Satisfies ensures every password generated by the policy is accepted by a server with the given requirements.
+func (p Policy) Satisfies(requirements Requirements) error {
+	var violations []string
+	for _, check := range []struct {
+		name     string
+		actual   int
+		required int
+	}{
+		{name: "length", actual: p.Length, required: requirements.MinLength},
+		{name: "lowercase", actual: p.Lowercase, required: requirements.MinLowercase},
+		{name: "uppercase", actual: p.Uppercase, required: requirements.MinUppercase},
+		{name: "digits", actual: p.Digits, required: requirements.MinDigits},
+		{name: "special", actual: p.Special, required: requirements.MinSpecial},
+	} {
+		if check.actual < check.required {
+			violations = append(violations, fmt.Sprintf("%s must be at least %d", check.name, check.required))
+		}
+	}
+	if len(violations) > 0 {
+		return ErrInvalidPolicy{Reason: "server requires " + strings.Join(violations, ", ")}
+	}
+	return nil
+}
+
+// Generate returns a random password following the policy, using a cryptographically secure source.
+func Generate(policy Policy) (string, error) {
+	if validationError := policy.Validate(); validationError != nil {
+		return "", validationError
+	}
+
+	var password []byte
+	var alphabet string
+	for _, class := range policy.classes() {
+		if class.minimum == 0 {
+			continue
+		}
+		alphabet += class.characters
+		for range class.minimum {
+			character, pickError := pick(class.characters)
+			if pickError != nil {
+				return "", pickError
+			}
+			password = append(password, character)
+		}
+	}
+	for len(password) < policy.Length {
+		character, pickError := pick(alphabet)
+		if pickError != nil {
+			return "", pickError
+		}
+		password = append(password, character)
+	}
+
+	// the mandatory characters must not stay at predictable positions
+	for i := len(password) - 1; i > 0; i-- {
+		j, randomError := randomInt(i + 1)
+		if randomError != nil {
+			return "", randomError
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
+
+func pick(characters string) (byte, error) {
+	index, randomError := randomInt(len(characters))
+	if randomError != nil {
+		return 0, randomError
+	}
+	return characters[index], nil
+}
+
+func randomInt(upperBound int) (int, error) {
+	number, randomError := rand.Int(rand.Reader, big.NewInt(int64(upperBound)))
+	if randomError != nil {
+		return 0, fmt.Errorf("failed to read random number: %w", randomError)
+	}
+	return int(number.Int64()), nil
+}
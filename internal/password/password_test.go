@@ -0,0 +1,77 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	for _, testCase := range []struct {
+		name   string
+		policy Policy
+	}{
+		{name: "default", policy: DefaultPolicy},
+		{name: "special characters", policy: Policy{Length: 16, Lowercase: 2, Uppercase: 2, Digits: 2, Special: 2}},
+		{name: "digits only", policy: Policy{Length: 8, Digits: 8}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			password, generateError := Generate(testCase.policy)
+			assert.NoError(t, generateError)
+			assert.Len(t, password, testCase.policy.Length)
+
+			for _, class := range testCase.policy.classes() {
+				var count int
+				for _, character := range password {
+					if strings.ContainsRune(class.characters, character) {
+						count++
+					}
+				}
+				assert.GreaterOrEqual(t, count, class.minimum)
+				if class.minimum == 0 {
+					assert.Zero(t, count)
+				}
+			}
+		})
+	}
+
+	t.Run("distinct passwords", func(t *testing.T) {
+		first, _ := Generate(DefaultPolicy)
+		second, _ := Generate(DefaultPolicy)
+		assert.NotEqual(t, first, second)
+	})
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, testCase := range []struct {
+		name     string
+		input    string
+		expected Policy
+		isValid  bool
+	}{
+		{name: "empty", input: "", expected: DefaultPolicy, isValid: true},
+		{name: "partial", input: "length=40, special=2", expected: Policy{Length: 40, Lowercase: 1, Uppercase: 1, Digits: 1, Special: 2}, isValid: true},
+		{name: "unknown setting", input: "symbols=2", isValid: false},
+		{name: "not a number", input: "length=long", isValid: false},
+		{name: "too short", input: "length=2", isValid: false},
+		{name: "no classes", input: "lowercase=0,uppercase=0,digits=0", isValid: false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, parseError := ParsePolicy(testCase.input)
+			if !testCase.isValid {
+				assert.Error(t, parseError)
+				return
+			}
+			assert.NoError(t, parseError)
+			assert.Equal(t, testCase.expected, actual)
+		})
+	}
+}
+
+func TestPolicy_Satisfies(t *testing.T) {
+	requirements := Requirements{MinLength: 8, MinLowercase: 1, MinUppercase: 1, MinDigits: 1, MinSpecial: 1}
+	assert.Error(t, DefaultPolicy.Satisfies(requirements))
+	assert.NoError(t, Policy{Length: 8, Lowercase: 1, Uppercase: 1, Digits: 1, Special: 1}.Satisfies(requirements))
+	assert.Error(t, Policy{Length: 6, Lowercase: 1, Uppercase: 1, Digits: 1, Special: 1}.Satisfies(requirements))
+}
@@ -3,35 +3,225 @@ package v1
 import (
 	"bytes"
 	"encoding/json"
-	"regexp"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"external-db-operator/internal/naming"
 )
 
+// DatabaseResource identifies the Database custom resource served by the api server.
+var DatabaseResource = schema.GroupVersionResource{
+	Group:    "bonsai-oss.org",
+	Version:  "v1",
+	Resource: "databases",
+}
+
+// DatabaseKind is the kind of the Database custom resource.
+const DatabaseKind = "Database"
+
 type Database struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec DatabaseSpec `json:"spec,omitempty"`
+	Spec   DatabaseSpec   `json:"spec,omitempty"`
+	Status DatabaseStatus `json:"status,omitempty"`
 }
 
-type DatabaseSpec struct{}
+type DatabaseSpec struct {
+	// ServerRef refers to the DatabaseServer the database is provisioned on. If empty, the default server of the
+	// operator is used. Immutable after provisioning.
+	ServerRef *ServerReference `json:"serverRef,omitempty"`
+	// DatabaseName overrides the operator naming template for the database name. It is a Go template itself.
+	DatabaseName string `json:"databaseName,omitempty"`
+	// Username overrides the operator naming template for the user name. It is a Go template itself.
+	Username string `json:"username,omitempty"`
 
-func (d *Database) AssembleDatabaseName() string {
-	return removeIllegalDatabaseCharacters(d.Namespace + "_" + d.Name)
+	// Users are additional users of the database, each with its own secret.
+	Users []DatabaseUser `json:"users,omitempty"`
+
+	// SecretTemplate renders additional keys of the secret from Go templates, extending the operator default.
+	SecretTemplate map[string]string `json:"secretTemplate,omitempty"`
+
+	// PasswordPolicy overrides the operator password policy for generated passwords.
+	PasswordPolicy *PasswordPolicy `json:"passwordPolicy,omitempty"`
+	// PasswordRotation configures the scheduled rotation of the user password.
+	PasswordRotation *PasswordRotation `json:"passwordRotation,omitempty"`
+
+	// DeletionPolicy is one of Delete, Retain or Snapshot. If empty, the operator default is used.
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// RevokeLogin disables the login of the user, if the database is retained on deletion.
+	RevokeLogin bool `json:"revokeLogin,omitempty"`
+
+	// Charset is the default character set of the database (mysql).
+	Charset string `json:"charset,omitempty"`
+	// Collation is the default collation of the database.
+	Collation string `json:"collation,omitempty"`
+	// Encoding is the character encoding of the database, immutable after creation (postgres).
+	Encoding string `json:"encoding,omitempty"`
+	// Locale sets collation and character classification of the database, immutable after creation (postgres).
+	Locale string `json:"locale,omitempty"`
+	// Template is the database the new database is copied from (postgres).
+	Template string `json:"template,omitempty"`
+	// Privileges are granted to the owner on the database instead of all privileges, e.g. SELECT (mysql).
+	Privileges []string `json:"privileges,omitempty"`
+	// MySQL holds the settings specific to the mysql provider.
+	MySQL *MySQLSpec `json:"mysql,omitempty"`
+	// Postgres holds the settings specific to the postgres provider.
+	Postgres *PostgresSpec `json:"postgres,omitempty"`
+	// Limits restrict the resources every user of the database may consume.
+	Limits *ResourceLimits `json:"limits,omitempty"`
+}
+
+// PostgresSpec holds the settings specific to the postgres provider.
+type PostgresSpec struct {
+	// Extensions are installed into the database by the operator, as the owner is not allowed to.
+	Extensions []PostgresExtension `json:"extensions,omitempty"`
+	// DropRemovedExtensions drops extensions removed from the list. Otherwise they stay installed, but unmanaged.
+	DropRemovedExtensions bool `json:"dropRemovedExtensions,omitempty"`
+	// Schemas are created within the database and handed over to their owners. Removed schemas are kept.
+	Schemas []PostgresSchema `json:"schemas,omitempty"`
+	// RevokePublicCreate revokes the CREATE privilege on the public schema from all users.
+	RevokePublicCreate bool `json:"revokePublicCreate,omitempty"`
+}
+
+// PostgresSchema is a schema within the database.
+type PostgresSchema struct {
+	Name string `json:"name"`
+	// Owner is the name of an additional user of the database. If empty, the owner of the database owns the schema.
+	Owner string `json:"owner,omitempty"`
+	// SearchPath adds the schema to the search path of its owner within the database, in the order of the list.
+	SearchPath bool `json:"searchPath,omitempty"`
+}
+
+// PostgresExtension is an extension installed into the database.
+type PostgresExtension struct {
+	// Name of the extension, e.g. pgcrypto.
+	Name string `json:"name"`
+	// Version of the extension. If empty, the default version is installed and kept.
+	Version string `json:"version,omitempty"`
+}
+
+// ResourceLimits restrict the resources of every user of the database. Omitted limits are lifted.
+type ResourceLimits struct {
+	// ConnectionLimit is the maximum number of concurrent connections per user.
+	ConnectionLimit int `json:"connectionLimit,omitempty"`
+	// StatementTimeout aborts statements running longer, e.g. 30s (postgres).
+	StatementTimeout string `json:"statementTimeout,omitempty"`
+	// IdleInTransactionSessionTimeout terminates sessions idling within an open transaction for longer, e.g. 5m (postgres).
+	IdleInTransactionSessionTimeout string `json:"idleInTransactionSessionTimeout,omitempty"`
+	// MaxQueriesPerHour, MaxUpdatesPerHour and MaxConnectionsPerHour limit the statements and connections per hour (mysql).
+	MaxQueriesPerHour     int `json:"maxQueriesPerHour,omitempty"`
+	MaxUpdatesPerHour     int `json:"maxUpdatesPerHour,omitempty"`
+	MaxConnectionsPerHour int `json:"maxConnectionsPerHour,omitempty"`
+}
+
+// MySQLSpec holds the settings specific to the mysql provider.
+type MySQLSpec struct {
+	// AllowedHosts are the hosts the users may connect from, e.g. 10.0.%. If empty, the operator default is used.
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+}
+
+// PasswordPolicy describes generated passwords. Every character class with a minimum greater than zero is used.
+type PasswordPolicy struct {
+	Length    *int `json:"length,omitempty"`
+	Lowercase *int `json:"lowercase,omitempty"`
+	Uppercase *int `json:"uppercase,omitempty"`
+	Digits    *int `json:"digits,omitempty"`
+	Special   *int `json:"special,omitempty"`
 }
 
-func removeIllegalDatabaseCharacters(input string) string {
-	return regexp.MustCompile("[.-]+").ReplaceAllString(input, "_")
+// DatabaseUser is an additional user of the database, besides the owner.
+type DatabaseUser struct {
+	// Name is appended to the name of the owner and the secret, e.g. readonly.
+	Name string `json:"name"`
+	// Profile is one of owner, readwrite or readonly.
+	Profile string `json:"profile"`
+}
+
+// DatabaseUserStatus describes a provisioned additional user.
+type DatabaseUserStatus struct {
+	Name       string `json:"name"`
+	Username   string `json:"username"`
+	SecretName string `json:"secretName"`
+	Profile    string `json:"profile"`
+}
+
+type PasswordRotation struct {
+	// Interval is the duration after which the password is rotated, e.g. 720h.
+	Interval string `json:"interval,omitempty"`
+	// Mode is either InPlace, changing the password of the user, or DualUser, switching between two logins. Defaults to InPlace.
+	Mode string `json:"mode,omitempty"`
+	// GracePeriod is the duration the previous login of a dual user rotation keeps its password, defaults to 1h.
+	GracePeriod string `json:"gracePeriod,omitempty"`
+}
+
+const (
+	PasswordRotationModeInPlace  = "InPlace"
+	PasswordRotationModeDualUser = "DualUser"
+)
+
+// DatabaseStatus describes the outcome of the latest reconciliation as observed by the operator.
+type DatabaseStatus struct {
+	// ObservedGeneration is the generation of the resource the status has been computed for.
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	// ServerName is the name of the DatabaseServer the database has been provisioned on, empty for the default server.
+	ServerName string `json:"serverName,omitempty"`
+	// DatabaseName is the name of the database on the database server.
+	DatabaseName string `json:"databaseName,omitempty"`
+	// Username is the name of the user owning the database.
+	Username string `json:"username,omitempty"`
+	// SecretName is the name of the secret holding the connection details.
+	SecretName string `json:"secretName,omitempty"`
+	// LastPasswordRotation is the time the current password has been set.
+	LastPasswordRotation *metav1.Time `json:"lastPasswordRotation,omitempty"`
+	// Users are the provisioned additional users.
+	Users []DatabaseUserStatus `json:"users,omitempty"`
+	// Extensions are the names of the extensions managed by the operator (postgres).
+	Extensions []string `json:"extensions,omitempty"`
+	// Logins are the users alternating in the secret, once dual user rotation has been used.
+	Logins []string `json:"logins,omitempty"`
+	// ActiveUsername is the login currently written to the secret by the dual user rotation.
+	ActiveUsername string `json:"activeUsername,omitempty"`
+	// RetiredUsername is the previous login of the dual user rotation, which still keeps its password.
+	RetiredUsername string `json:"retiredUsername,omitempty"`
+	// RetiredPasswordResetAt is the time the password of the retired login gets reset.
+	RetiredPasswordResetAt *metav1.Time `json:"retiredPasswordResetAt,omitempty"`
+	// DeletionPolicy is the effective deletion policy applied once the resource gets deleted.
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// SnapshotName is the file name of the snapshot taken on deletion, pinned before the snapshot is taken.
+	SnapshotName string `json:"snapshotName,omitempty"`
+	// LastError is the error message of the latest failed reconciliation.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// RotatePasswordAnnotation requests an immediate password rotation. It is removed once the password has been rotated.
+const RotatePasswordAnnotation = "bonsai-oss.org/rotate-password"
+
+const (
+	ConditionReady        = "Ready"
+	ConditionProvisioning = "Provisioning"
+	ConditionFailed       = "Failed"
+)
+
+func (d *Database) AssembleDatabaseName() string {
+	return naming.Sanitize(d.Namespace + "_" + d.Name)
 }
 
 func FromUnstructured(data any) (*Database, error) {
-	buf := bytes.NewBuffer(nil)
 	databaseResourceData := &Database{}
-	if encodeError := json.NewEncoder(buf).Encode(data); encodeError != nil {
-		return nil, encodeError
+	if decodeError := decode(data, databaseResourceData); decodeError != nil {
+		return databaseResourceData, decodeError
 	}
-	decodeError := json.NewDecoder(buf).Decode(databaseResourceData)
+	return databaseResourceData, nil
+}
 
-	return databaseResourceData, decodeError
+// decode converts the unstructured data into the typed resource.
+func decode(data any, target any) error {
+	buf := bytes.NewBuffer(nil)
+	if encodeError := json.NewEncoder(buf).Encode(data); encodeError != nil {
+		return encodeError
+	}
+	return json.NewDecoder(buf).Decode(target)
 }
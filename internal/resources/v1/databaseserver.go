@@ -0,0 +1,71 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DatabaseServerResource identifies the cluster scoped DatabaseServer custom resource served by the api server.
+var DatabaseServerResource = schema.GroupVersionResource{
+	Group:    "bonsai-oss.org",
+	Version:  "v1",
+	Resource: "databaseservers",
+}
+
+// DefaultInstance is the operator instance provisioning databases on DatabaseServers, which do not name one.
+const DefaultInstance = "default"
+
+// DatabaseServer describes a database server, on which Database resources referring to it are provisioned.
+type DatabaseServer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DatabaseServerSpec `json:"spec,omitempty"`
+}
+
+type DatabaseServerSpec struct {
+	// Provider is the name of the database provider, e.g. postgres or mysql.
+	Provider string `json:"provider"`
+	Host     string `json:"host"`
+	Port     uint16 `json:"port"`
+	// Database is the database the operator connects to, e.g. postgres.
+	Database string `json:"database,omitempty"`
+	// Parameters are passed on to the database driver, e.g. sslmode.
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// CredentialsSecretRef refers to the secret holding the credentials of the administrative user.
+	CredentialsSecretRef SecretReference `json:"credentialsSecretRef"`
+	// Instance is the name of the operator instance provisioning the Database resources referring to the server, which
+	// carry no instance label. Defaults to DefaultInstance.
+	Instance string `json:"instance,omitempty"`
+	// Pool shapes the connection pool of the operator to the server, overriding the defaults of the operator.
+	Pool *ConnectionPool `json:"pool,omitempty"`
+}
+
+// ConnectionPool shapes the pool of connections to a database server. Unset fields keep the defaults of the operator.
+type ConnectionPool struct {
+	// MaxConnections limits the number of open connections.
+	MaxConnections int `json:"maxConnections,omitempty"`
+	// ConnectionLifetime is the age after which connections are replaced, e.g. 1h.
+	ConnectionLifetime string `json:"connectionLifetime,omitempty"`
+	// HealthCheckInterval is the interval in which idle connections are checked, e.g. 1m (postgres).
+	HealthCheckInterval string `json:"healthCheckInterval,omitempty"`
+}
+
+// SecretReference refers to a secret in any namespace.
+type SecretReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// UsernameKey and PasswordKey are the keys of the credentials within the secret, defaulting to username and password.
+	UsernameKey string `json:"usernameKey,omitempty"`
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// ServerReference refers to a DatabaseServer resource.
+type ServerReference struct {
+	Name string `json:"name"`
+}
+
+func DatabaseServerFromUnstructured(data any) (*DatabaseServer, error) {
+	databaseServerData := &DatabaseServer{}
+	return databaseServerData, decode(data, databaseServerData)
+}
@@ -0,0 +1,78 @@
+package secret
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"external-db-operator/internal/database"
+)
+
+// ReservedKeys are always written by the operator and cannot be replaced by a template.
+var ReservedKeys = []string{"username", "password", "host", "port", "database"}
+
+// Template renders additional secret keys from Go templates. The templates have access to the fields of
+// database.Credentials and to the helper functions uri, jdbcUrl and dotnetConnectionString.
+type Template struct {
+	templates map[string]*template.Template
+}
+
+// placeholderFunctions make the helper functions known at parse time, they are replaced on every render.
+var placeholderFunctions = connectionFunctions(database.ConnectionStrings{})
+
+func connectionFunctions(connectionStrings database.ConnectionStrings) template.FuncMap {
+	return template.FuncMap{
+		"uri":                    func() string { return connectionStrings.URI },
+		"jdbcUrl":                func() string { return connectionStrings.JDBCURL },
+		"dotnetConnectionString": func() string { return connectionStrings.DotNetConnectionString },
+	}
+}
+
+// Parse parses the templates by secret key. An empty map results in a template without keys.
+func Parse(keys map[string]string) (*Template, error) {
+	templates := make(map[string]*template.Template, len(keys))
+	for key, text := range keys {
+		if slices.Contains(ReservedKeys, key) {
+			return nil, fmt.Errorf("secret key %q is reserved", key)
+		}
+		if validationErrors := validation.IsConfigMapKey(key); len(validationErrors) > 0 {
+			return nil, fmt.Errorf("invalid secret key %q: %s", key, strings.Join(validationErrors, ", "))
+		}
+		parsedTemplate, parseError := template.New(key).Funcs(placeholderFunctions).Option("missingkey=error").Parse(text)
+		if parseError != nil {
+			return nil, fmt.Errorf("failed to parse template of secret key %q: %w", key, parseError)
+		}
+		templates[key] = parsedTemplate
+	}
+	return &Template{templates: templates}, nil
+}
+
+// Override returns a template containing the keys of both templates, preferring the ones of other.
+func (t *Template) Override(other *Template) *Template {
+	templates := maps.Clone(t.templates)
+	maps.Copy(templates, other.templates)
+	return &Template{templates: templates}
+}
+
+// Render executes all templates for the given credentials and returns the rendered values by secret key.
+func (t *Template) Render(credentials database.Credentials, connectionStrings database.ConnectionStrings) (map[string]string, error) {
+	functions := connectionFunctions(connectionStrings)
+	rendered := make(map[string]string, len(t.templates))
+	for key, keyTemplate := range t.templates {
+		cloned, cloneError := keyTemplate.Clone()
+		if cloneError != nil {
+			return nil, fmt.Errorf("failed to clone template of secret key %q: %w", key, cloneError)
+		}
+
+		var builder strings.Builder
+		if executeError := cloned.Funcs(functions).Execute(&builder, credentials); executeError != nil {
+			return nil, fmt.Errorf("failed to render secret key %q: %w", key, executeError)
+		}
+		rendered[key] = builder.String()
+	}
+	return rendered, nil
+}
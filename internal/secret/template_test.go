@@ -0,0 +1,52 @@
+package secret
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"external-db-operator/internal/database"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	credentials := database.Credentials{Host: "localhost", Port: 5432, Database: "foo_bar", Username: "foo_bar", Password: "secret"}
+	connectionStrings := database.ConnectionStrings{URI: "postgres://uri", JDBCURL: "jdbc:postgresql://uri", DotNetConnectionString: "Host=localhost"}
+
+	operatorTemplate, parseError := Parse(map[string]string{
+		"uri":      "{{ uri }}",
+		"endpoint": "{{ .Host }}:{{ .Port }}",
+	})
+	assert.NoError(t, parseError)
+	resourceTemplate, parseError := Parse(map[string]string{
+		"endpoint":          "{{ .Host }}",
+		"JDBC_URL":          "{{ jdbcUrl }}",
+		"connection.string": "{{ dotnetConnectionString }}",
+	})
+	assert.NoError(t, parseError)
+
+	actual, renderError := operatorTemplate.Override(resourceTemplate).Render(credentials, connectionStrings)
+	assert.NoError(t, renderError)
+	assert.Equal(t, map[string]string{
+		"uri":               "postgres://uri",
+		"endpoint":          "localhost",
+		"JDBC_URL":          "jdbc:postgresql://uri",
+		"connection.string": "Host=localhost",
+	}, actual)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, testCase := range []struct {
+		name string
+		keys map[string]string
+	}{
+		{name: "reserved key", keys: map[string]string{"password": "{{ .Password }}"}},
+		{name: "invalid key", keys: map[string]string{"foo/bar": "baz"}},
+		{name: "invalid template", keys: map[string]string{"uri": "{{ uri "}},
+		{name: "unknown function", keys: map[string]string{"uri": "{{ unknown }}"}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, parseError := Parse(testCase.keys)
+			assert.Error(t, parseError)
+		})
+	}
+}